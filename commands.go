@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
+	"github.com/chrisbradleydev/go-k8s/pkg/k8s"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/yaml"
+)
+
+func runWait(ctx context.Context, app *k8s.Application, opts *options, args []string) error {
+	if len(args) > 0 {
+		return &usageError{msg: "wait takes no arguments"}
+	}
+	if err := setUpWait(app, opts); err != nil {
+		return err
+	}
+
+	manifest, err := loadOwnManifest(ctx, app, opts, "wait")
+	if err != nil {
+		return err
+	}
+	return waitResult(app.WaitForCloudSQL(ctx, manifest))
+}
+
+// runApply creates or updates the SQL instances, databases and users of the
+// manifest, then waits on it like wait.
+func runApply(ctx context.Context, app *k8s.Application, opts *options, args []string) error {
+	if len(args) > 0 {
+		return &usageError{msg: "apply takes no arguments"}
+	}
+	if opts.manifest == "" {
+		return &usageError{msg: "apply needs a manifest (-f)"}
+	}
+	if err := setUpWait(app, opts); err != nil {
+		return err
+	}
+
+	manifest, err := loadOwnManifest(ctx, app, opts, "apply")
+	if err != nil {
+		return err
+	}
+	return waitResult(app.ApplyCloudSQL(ctx, manifest))
+}
+
+// runDiff prints how the manifest differs from the cluster, and exits with
+// exitFailed when it does, like diff(1).
+func runDiff(ctx context.Context, app *k8s.Application, opts *options, args []string) error {
+	if len(args) > 0 {
+		return &usageError{msg: "diff takes no arguments"}
+	}
+	if opts.manifest == "" {
+		return &usageError{msg: "diff needs a manifest (-f)"}
+	}
+	format := k8s.OutputFormat(opts.output)
+	if format != k8s.OutputText && format != k8s.OutputJSON {
+		return &usageError{msg: fmt.Sprintf("diff output must be %s or %s", k8s.OutputText, k8s.OutputJSON)}
+	}
+
+	manifest, err := k8s.LoadManifestFile(opts.manifest)
+	if err != nil {
+		return &exitError{code: exitUsage, err: err}
+	}
+	diff, err := app.DiffCloudSQL(ctx, manifest)
+	if err != nil {
+		return err
+	}
+
+	if format == k8s.OutputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diff); err != nil {
+			return err
+		}
+	} else {
+		fmt.Print(diff.String())
+	}
+	if !diff.Empty() {
+		return &exitError{code: exitFailed, err: fmt.Errorf("%d resources differ from the manifest", len(diff.Resources))}
+	}
+	return nil
+}
+
+// setUpWait sets the printer and timeouts of wait and apply.
+func setUpWait(app *k8s.Application, opts *options) error {
+	printerOptions, err := opts.printerOptions()
+	if err != nil {
+		return &usageError{msg: err.Error()}
+	}
+	printer, err := k8s.NewPrinter(k8s.OutputFormat(opts.output), os.Stdout, printerOptions...)
+	if err != nil {
+		return &usageError{msg: err.Error()}
+	}
+	app.SetPrinter(printer)
+	if opts.timeoutSet {
+		app.SetWaitTimeouts(k8s.Timeouts{Overall: &metav1.Duration{Duration: opts.timeout}})
+	}
+	return nil
+}
+
+// waitResult maps the outcome of a wait to the exit code.
+func waitResult(report *k8s.WaitReport, err error) error {
+	if err != nil {
+		return &exitError{code: exitUsage, err: err}
+	}
+	if code := report.ExitCode(); code != exitOK {
+		return &exitError{code: code, err: report.Err()}
+	}
+	return nil
+}
+
+// loadManifest reads the manifest given with -f, or discovers one.
+func loadManifest(ctx context.Context, app *k8s.Application, opts *options, command string) (*k8s.SqlManifest, error) {
+	var manifest *k8s.SqlManifest
+	var err error
+	switch {
+	case opts.manifest != "":
+		manifest, err = k8s.LoadManifestFile(opts.manifest)
+	case opts.discover || opts.selector != "":
+		manifest, err = app.DiscoverManifest(ctx, opts.selector)
+	default:
+		return nil, &usageError{msg: command + " needs a manifest (-f) or discovery (-discover, -l)"}
+	}
+	if err != nil {
+		return nil, &exitError{code: exitUsage, err: err}
+	}
+	return manifest, nil
+}
+
+// loadOwnManifest loads the manifest of an ownDeadline command, whose
+// deadline is only known once the manifest is. Discovery is bounded by
+// -timeout, DefaultWaitTimeout when it isn't given, so that it can't hang.
+func loadOwnManifest(ctx context.Context, app *k8s.Application, opts *options, command string) (*k8s.SqlManifest, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+	return loadManifest(ctx, app, opts, command)
+}
+
+// runMonitor keeps watching the manifest's resources and serves their state
+// as Prometheus metrics on -listen until interrupted.
+func runMonitor(ctx context.Context, app *k8s.Application, opts *options, args []string) error {
+	if len(args) > 0 {
+		return &usageError{msg: "monitor takes no arguments"}
+	}
+
+	metrics := k8s.NewMetrics()
+	app.SetMetrics(metrics)
+	manifest, err := loadManifest(ctx, app, opts, "monitor")
+	if err != nil {
+		return err
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	listener, err := net.Listen("tcp", opts.listen)
+	if err != nil {
+		return &exitError{code: exitUsage, err: err}
+	}
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+	app.Logger().Info("serving metrics", "url", fmt.Sprintf("http://%s/metrics", listener.Addr()))
+
+	monitorCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	monitorErr := make(chan error, 1)
+	go func() {
+		monitorErr <- app.MonitorCloudSQL(monitorCtx, manifest, metrics.Observe)
+	}()
+
+	select {
+	case err = <-serveErr:
+		stop()
+		<-monitorErr
+	case err = <-monitorErr:
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if shutdownErr := server.Shutdown(shutdownCtx); err == nil {
+		err = shutdownErr
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	return err
+}
+
+func runPlan(ctx context.Context, app *k8s.Application, opts *options, args []string) error {
+	if len(args) > 0 {
+		return &usageError{msg: "plan takes no arguments"}
+	}
+	if opts.manifest == "" {
+		return &usageError{msg: "plan needs a manifest (-f)"}
+	}
+
+	manifest, err := k8s.LoadManifestFile(opts.manifest)
+	if err != nil {
+		return &exitError{code: exitUsage, err: err}
+	}
+	plan, err := app.PlanManifest(ctx, manifest)
+	if err != nil {
+		return &exitError{code: exitUsage, err: err}
+	}
+	fmt.Print(plan.String())
+	return nil
+}
+
+func runList(ctx context.Context, app *k8s.Application, _ *options, args []string) error {
+	if len(args) > 0 {
+		return &usageError{msg: "list takes no arguments"}
+	}
+
+	list, err := app.GetInstanceList(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATE\tREASON\tAGE")
+	for i := range list.Items {
+		instance := &list.Items[i]
+		readiness, _ := k8s.ObjectReadiness(instance)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			instance.Name,
+			readiness.State,
+			conditionReason(readiness.Condition),
+			age(instance.CreationTimestamp.Time))
+	}
+	return w.Flush()
+}
+
+func runGet(ctx context.Context, app *k8s.Application, _ *options, args []string) error {
+	if len(args) != 1 {
+		return &usageError{msg: "get takes exactly one instance name"}
+	}
+
+	instance, err := app.GetInstance(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	out, err := yaml.Marshal(instance)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+func runWatch(ctx context.Context, app *k8s.Application, _ *options, args []string) error {
+	if len(args) != 1 {
+		return &usageError{msg: "watch takes exactly one instance name"}
+	}
+
+	return app.WatchInstanceFunc(ctx, args[0], func(change k8s.InstanceChange) error {
+		message := ""
+		if change.Readiness.Condition != nil {
+			message = change.Readiness.Condition.Message
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n",
+			change.Type,
+			change.Instance.Name,
+			change.Readiness.State,
+			conditionReason(change.Readiness.Condition),
+			message)
+		return nil
+	})
+}
+
+func runRollout(ctx context.Context, app *k8s.Application, _ *options, args []string) error {
+	if len(args) == 0 {
+		return &usageError{msg: "rollout takes one or more deployment names"}
+	}
+
+	for _, name := range args {
+		status, err := app.WaitForDeploymentRollout(ctx, name)
+		var rerr *k8s.RolloutError
+		if errors.As(err, &rerr) {
+			fmt.Fprint(os.Stderr, rerr.Logs())
+		}
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return &exitError{code: k8s.ExitTimeout, err: err}
+			}
+			return err
+		}
+		fmt.Println(status.Message)
+	}
+	return nil
+}
+
+func runStatus(ctx context.Context, app *k8s.Application, _ *options, args []string) error {
+	var deployments []appsv1.Deployment
+	if len(args) == 0 {
+		list, err := app.GetDeploymentList(ctx)
+		if err != nil {
+			return err
+		}
+		deployments = list.Items
+	}
+	for _, name := range args {
+		deploy, err := app.GetDeployment(ctx, name)
+		if err != nil {
+			return err
+		}
+		deployments = append(deployments, *deploy)
+	}
+
+	pods, err := app.GetPods(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "DEPLOYMENT\tREADY\tUP-TO-DATE\tAVAILABLE\tAGE")
+	for _, deploy := range deployments {
+		var replicas int32 = 1
+		if deploy.Spec.Replicas != nil {
+			replicas = *deploy.Spec.Replicas
+		}
+		fmt.Fprintf(w, "%s\t%d/%d\t%d\t%d\t%s\n",
+			deploy.Name,
+			deploy.Status.ReadyReplicas,
+			replicas,
+			deploy.Status.UpdatedReplicas,
+			deploy.Status.AvailableReplicas,
+			age(deploy.CreationTimestamp.Time))
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "POD\tREADY\tSTATUS\tRESTARTS\tAGE")
+	for _, pod := range pods.Items {
+		ready, restarts := 0, int32(0)
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Ready {
+				ready++
+			}
+			restarts += cs.RestartCount
+		}
+		fmt.Fprintf(w, "%s\t%d/%d\t%s\t%d\t%s\n",
+			pod.Name,
+			ready,
+			len(pod.Spec.Containers),
+			pod.Status.Phase,
+			restarts,
+			age(pod.CreationTimestamp.Time))
+	}
+	return w.Flush()
+}
+
+func runDiagnose(ctx context.Context, app *k8s.Application, opts *options, args []string) error {
+	diagnoses, err := app.DiagnosePods(ctx, "", k8s.DiagnoseOptions{Selector: opts.selector, Names: args, LogLines: opts.tail})
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(args))
+	for _, name := range args {
+		wanted[name] = true
+	}
+	notReady := 0
+	for i := range diagnoses {
+		d := &diagnoses[i]
+		delete(wanted, d.Name)
+		if !d.Ready {
+			notReady++
+		}
+		fmt.Println(d.String())
+	}
+	for _, name := range args {
+		if wanted[name] {
+			return fmt.Errorf("pod %q not found", name)
+		}
+	}
+	if notReady > 0 {
+		return &exitError{code: exitFailed, err: fmt.Errorf("%d pods aren't ready", notReady)}
+	}
+	return nil
+}
+
+func conditionReason(condition *v1alpha1.Condition) string {
+	if condition == nil {
+		return "Unknown"
+	}
+	return condition.Reason
+}
+
+func age(t time.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(t))
+}
@@ -1,12 +1,272 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
 	"github.com/chrisbradleydev/go-k8s/pkg/k8s"
+	"golang.org/x/term"
+)
+
+const (
+	exitOK     = k8s.ExitReady
+	exitFailed = k8s.ExitFailed
+	exitUsage  = k8s.ExitConfigError
 )
 
-const namespace = "chrisbradley"
+const defaultTimeout = k8s.DefaultWaitTimeout
+
+type options struct {
+	namespace  string
+	kubeconfig string
+	context    string
+	manifest   string
+	selector   string
+	discover   bool
+	output     string
+	timeout    time.Duration
+	timeoutSet bool
+	as         string
+	asGroups   stringList
+	tail       int64
+	verbose    bool
+	logFormat  string
+	listen     string
+	color      string
+	theme      string
+}
+
+// stringList is a flag that can be given more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, app *k8s.Application, opts *options, args []string) error
+	// daemon commands run until interrupted, so -timeout only applies when
+	// it is given.
+	daemon bool
+	// ownDeadline commands take their deadline from the manifest, which
+	// -timeout overrides when it is given. Discovering the manifest is bound
+	// by -timeout, or its default, either way.
+	ownDeadline bool
+}
+
+var commands = []*command{
+	{name: "wait", summary: "wait for SQL instance groups to become ready", run: runWait, ownDeadline: true},
+	{name: "apply", summary: "create or update the SQL instances, databases and users of a manifest, then wait for them", run: runApply, ownDeadline: true},
+	{name: "diff", summary: "show how a manifest's SQL instances, databases and users differ from the cluster", run: runDiff},
+	{name: "plan", summary: "print the order wait would run a manifest in", run: runPlan},
+	{name: "list", summary: "list SQL instances", run: runList},
+	{name: "get", args: "NAME", summary: "print a SQL instance", run: runGet},
+	{name: "watch", args: "NAME", summary: "stream changes to a SQL instance", run: runWatch},
+	{name: "monitor", summary: "keep watching SQL instance groups and serve Prometheus metrics", run: runMonitor, daemon: true},
+	{name: "rollout", args: "DEPLOYMENT...", summary: "wait for deployment rollouts to finish", run: runRollout},
+	{name: "status", args: "[DEPLOYMENT...]", summary: "show deployment and pod status", run: runStatus},
+	{name: "diagnose", args: "[POD...]", summary: "explain why pods aren't ready, with their recent logs", run: runDiagnose},
+}
+
+// usageError marks errors caused by how the command was invoked rather than
+// by the cluster, so they map to exitUsage.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+// exitError carries a specific exit code out of a command.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
 
 func main() {
-	app := k8s.NewApp(namespace)
-	app.WaitForCloudSQL()
-}
\ No newline at end of file
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" || args[0] == "help" {
+		usage()
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	cmd := lookupCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		usage()
+		return exitUsage
+	}
+
+	opts := &options{}
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	opts.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: go-k8s %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	logger, err := opts.logger()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	app, err := k8s.New(append(opts.appOptions(), k8s.WithLogger(logger))...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	opts.timeoutSet = flagSet(fs, "timeout")
+	if !cmd.ownDeadline && (!cmd.daemon || opts.timeoutSet) {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+
+	if err := cmd.run(ctx, app, opts, fs.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		var uerr *usageError
+		if errors.As(err, &uerr) {
+			return exitUsage
+		}
+		var eerr *exitError
+		if errors.As(err, &eerr) {
+			return eerr.code
+		}
+		return exitFailed
+	}
+	return exitOK
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.namespace, "n", "", "namespace (defaults to the kubeconfig context or pod namespace)")
+	fs.StringVar(&o.namespace, "namespace", "", "namespace (defaults to the kubeconfig context or pod namespace)")
+	fs.StringVar(&o.kubeconfig, "kubeconfig", "", "path to the kubeconfig file (defaults to $KUBECONFIG or ~/.kube/config)")
+	fs.StringVar(&o.context, "context", "", "kubeconfig context to use")
+	fs.StringVar(&o.as, "as", "", "user to impersonate")
+	fs.Var(&o.asGroups, "as-group", "group to impersonate, can be repeated")
+	fs.DurationVar(&o.timeout, "timeout", defaultTimeout, "give up after this long; for wait and apply, overrides the manifest's overall timeout")
+	fs.StringVar(&o.manifest, "f", "", "path to a SQL manifest (YAML or JSON), or - for stdin")
+	fs.StringVar(&o.manifest, "manifest", "", "path to a SQL manifest (YAML or JSON), or - for stdin")
+	fs.StringVar(&o.selector, "l", "", "label selector used for discovery, e.g. app=foo; the databases and users of a matching instance are included")
+	fs.BoolVar(&o.discover, "discover", false, "discover SQL resources in the namespace instead of using a manifest")
+	fs.Int64Var(&o.tail, "tail", k8s.DefaultLogLines, "log lines to show for each failing container")
+	fs.BoolVar(&o.verbose, "v", false, "log debug detail")
+	fs.StringVar(&o.logFormat, "log-format", "text", "format of the logs on stderr, text or json")
+	fs.StringVar(&o.listen, "listen", ":9090", "address monitor serves /metrics on")
+	fs.StringVar(&o.color, "color", string(k8s.ColorAuto), "when to color text output: auto, always or never; auto honors NO_COLOR and FORCE_COLOR")
+	fs.StringVar(&o.theme, "theme", "default", fmt.Sprintf("colors of text output, one of %v", k8s.ThemeNames()))
+	fs.StringVar(&o.output, "o", string(k8s.OutputText), fmt.Sprintf("output format for wait and apply, one of %v; diff takes text or json", k8s.OutputFormats))
+}
+
+func (o *options) printerOptions() ([]k8s.PrinterOption, error) {
+	theme, err := k8s.LookupTheme(o.theme)
+	if err != nil {
+		return nil, err
+	}
+	switch mode := k8s.ColorMode(o.color); mode {
+	case k8s.ColorAuto, k8s.ColorAlways, k8s.ColorNever:
+		return []k8s.PrinterOption{k8s.WithTheme(theme), k8s.WithColor(mode)}, nil
+	}
+	return nil, fmt.Errorf("unknown color mode %q, must be auto, always or never", o.color)
+}
+
+func (o *options) appOptions() []k8s.Option {
+	appOptions := []k8s.Option{
+		k8s.WithKubeconfig(o.kubeconfig),
+		k8s.WithContext(o.context),
+		k8s.WithNamespace(o.namespace),
+		k8s.WithUserAgent("go-k8s"),
+	}
+	if o.as != "" {
+		appOptions = append(appOptions, k8s.WithImpersonation(o.as, o.asGroups...))
+	}
+	return appOptions
+}
+
+// logger writes logs to stderr, apart from the output on stdout. Debug
+// detail is only logged with -v. The dashboard shows what the info and warn
+// lines would say, and they would scroll it off the screen, so only errors
+// are logged while it is up.
+func (o *options) logger() (*slog.Logger, error) {
+	handlerOptions := &slog.HandlerOptions{Level: slog.LevelInfo}
+	switch {
+	case o.verbose:
+		handlerOptions.Level = slog.LevelDebug
+	case k8s.OutputFormat(o.output) == k8s.OutputTUI && term.IsTerminal(int(os.Stdout.Fd())):
+		handlerOptions.Level = slog.LevelError
+	}
+	switch o.logFormat {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, handlerOptions)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, handlerOptions)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, must be text or json", o.logFormat)
+}
+
+// flagSet reports whether the named flag was given.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func lookupCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: go-k8s <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'go-k8s <command> -h' for the flags of a command.")
+}
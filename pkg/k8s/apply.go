@@ -0,0 +1,180 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
+	v1beta1 "github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/sql/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// FieldManager owns the fields of the objects ApplyCloudSQL applies.
+const FieldManager = "go-k8s"
+
+// ApplyCloudSQL creates or updates the SQL instances, databases and users of
+// the manifest with server-side apply, then waits on everything in it like
+// WaitForCloudSQL. Other resources and workloads are only waited on. When
+// the manifest can't be applied the error is returned and nothing is waited
+// on. The overall timeout covers applying as well as waiting.
+func (app *Application) ApplyCloudSQL(ctx context.Context, manifest *SqlManifest) (*WaitReport, error) {
+	ctx, cancel := withBudget(ctx, "overall", app.waitTimeouts(manifest).overall())
+	defer cancel()
+
+	groups := NewSqlInstanceGroupList(ctx, app)
+	if err := groups.InitGroupsFromManifest(manifest); err != nil {
+		return nil, err
+	}
+	if err := manifest.validateApply(); err != nil {
+		return nil, err
+	}
+	for _, group := range groups.Groups {
+		if err := group.apply(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return app.WaitForCloudSQL(ctx, manifest)
+}
+
+// validateApply reports what the manifest lacks to be applied, on top of
+// what Validate checks.
+func (m *SqlManifest) validateApply() error {
+	var errs []error
+	for i, instance := range m.Instances {
+		if instance.Tier == "" {
+			errs = append(errs, fmt.Errorf("instances[%d]: instance %q needs a tier to be applied", i, instance.Name))
+		}
+	}
+	for i, user := range m.Users {
+		if ref := user.PasswordSecretRef; ref != nil && (ref.Name == "" || ref.Key == "") {
+			errs = append(errs, fmt.Errorf("users[%d]: user %q passwordSecretRef needs a name and a key", i, user.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// apply server-side applies the group's instance, databases and users, in
+// that order. Fields other managers own are taken over, as the manifest is
+// the source of truth for them.
+func (g *SqlInstanceGroup) apply(ctx context.Context) error {
+	app, err := g.app.Cluster(g.Cluster)
+	if err != nil {
+		return err
+	}
+	sql := app.cnrmClient.SqlV1beta1()
+	force := true
+	opts := metav1.PatchOptions{FieldManager: FieldManager, Force: &force}
+
+	instance := g.instanceObject()
+	data, err := applyPatch(instance)
+	if err == nil {
+		_, err = sql.SQLInstances(instance.Namespace).Patch(ctx, instance.Name, types.ApplyPatchType, data, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("apply %s %s: %w", SqlResourceInstance, instance.Name, err)
+	}
+	g.app.resourceLogger(g.baseEvent(SqlResourceInstance, g.Name, "", "")).Info("resource applied")
+
+	for _, db := range g.Databases {
+		database := g.databaseObject(db)
+		data, err := applyPatch(database)
+		if err == nil {
+			_, err = sql.SQLDatabases(database.Namespace).Patch(ctx, database.Name, types.ApplyPatchType, data, opts)
+		}
+		if err != nil {
+			return fmt.Errorf("apply %s %s: %w", SqlResourceDatabase, database.Name, err)
+		}
+		g.app.resourceLogger(g.baseEvent(SqlResourceDatabase, db.Name, db.Namespace, "")).Info("resource applied")
+	}
+
+	for _, u := range g.Users {
+		user := g.userObject(u)
+		data, err := applyPatch(user)
+		if err == nil {
+			_, err = sql.SQLUsers(user.Namespace).Patch(ctx, user.Name, types.ApplyPatchType, data, opts)
+		}
+		if err != nil {
+			return fmt.Errorf("apply %s %s: %w", SqlResourceUser, user.Name, err)
+		}
+		g.app.resourceLogger(g.baseEvent(SqlResourceUser, u.Name, u.Namespace, "")).Info("resource applied")
+	}
+	return nil
+}
+
+// instanceObject returns the SQLInstance the group's instance is applied as.
+func (g *SqlInstanceGroup) instanceObject() *v1beta1.SQLInstance {
+	instance := &v1beta1.SQLInstance{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1beta1.SchemeGroupVersion.String(), Kind: "SQLInstance"},
+		ObjectMeta: metav1.ObjectMeta{Name: g.Name, Namespace: g.namespaceFor("")},
+	}
+	if g.Instance != nil {
+		instance.Spec.Settings.Tier = g.Instance.Tier
+		instance.Spec.Region = optional(g.Instance.Region)
+		instance.Spec.DatabaseVersion = optional(g.Instance.DatabaseVersion)
+	}
+	return instance
+}
+
+func (g *SqlInstanceGroup) databaseObject(db *SqlDatabase) *v1beta1.SQLDatabase {
+	namespace := g.namespaceFor(db.Namespace)
+	return &v1beta1.SQLDatabase{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1beta1.SchemeGroupVersion.String(), Kind: "SQLDatabase"},
+		ObjectMeta: metav1.ObjectMeta{Name: db.Name, Namespace: namespace},
+		Spec: v1beta1.SQLDatabaseSpec{
+			InstanceRef: g.instanceRef(namespace),
+			Charset:     optional(db.Charset),
+			Collation:   optional(db.Collation),
+		},
+	}
+}
+
+func (g *SqlInstanceGroup) userObject(u *SqlUser) *v1beta1.SQLUser {
+	namespace := g.namespaceFor(u.Namespace)
+	user := &v1beta1.SQLUser{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1beta1.SchemeGroupVersion.String(), Kind: "SQLUser"},
+		ObjectMeta: metav1.ObjectMeta{Name: u.Name, Namespace: namespace},
+		Spec:       v1beta1.SQLUserSpec{InstanceRef: g.instanceRef(namespace)},
+	}
+	if u.PasswordSecretRef != nil {
+		ref := *u.PasswordSecretRef
+		user.Spec.Password = &v1beta1.UserPassword{
+			ValueFrom: &v1beta1.UserValueFrom{SecretKeyRef: &ref},
+		}
+	}
+	return user
+}
+
+// instanceRef points a database or user in namespace at the group's
+// instance.
+func (g *SqlInstanceGroup) instanceRef(namespace string) v1alpha1.ResourceRef {
+	ref := v1alpha1.ResourceRef{Name: g.Name}
+	if instanceNamespace := g.namespaceFor(""); instanceNamespace != namespace {
+		ref.Namespace = instanceNamespace
+	}
+	return ref
+}
+
+// applyPatch encodes obj as an apply patch. The status and the empty
+// creation timestamp of typed objects are left out, so that the patch only
+// holds fields the manifest sets.
+func applyPatch(obj runtime.Object) ([]byte, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(u, "status")
+	unstructured.RemoveNestedField(u, "metadata", "creationTimestamp")
+	return json.Marshal(u)
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,93 @@
+package k8s_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chrisbradleydev/go-k8s/pkg/k8s"
+	"github.com/chrisbradleydev/go-k8s/pkg/k8s/k8stest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const applyManifest = `
+instances:
+- name: uno
+  tier: db-f1-micro
+  region: us-central1
+  databaseVersion: MYSQL_8_0
+databases:
+- name: uno-db
+  instanceName: uno
+  charset: utf8mb4
+users:
+- name: uno-user
+  instanceName: uno
+  passwordSecretRef:
+    name: uno-user-password
+    key: password
+`
+
+func TestApply(t *testing.T) {
+	c := k8stest.NewCluster("default")
+	m, err := k8s.LoadManifest(strings.NewReader(applyManifest))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	errs := c.Start(ctx,
+		k8stest.Step{After: 300 * time.Millisecond, Kind: k8s.SqlResourceInstance, Name: "uno", Reason: k8s.ReasonUpToDate},
+		k8stest.Step{Kind: k8s.SqlResourceDatabase, Name: "uno-db", Reason: k8s.ReasonUpToDate},
+		k8stest.Step{Kind: k8s.SqlResourceUser, Name: "uno-user", Reason: k8s.ReasonUpToDate},
+	)
+
+	printer, err := k8s.NewPrinter(k8s.OutputText, io.Discard)
+	require.NoError(t, err)
+	app := c.App()
+	app.SetPrinter(printer)
+	report, err := app.ApplyCloudSQL(ctx, m)
+	require.NoError(t, err)
+	assert.Equal(t, k8s.ExitReady, report.ExitCode(), report.String())
+	cancel()
+	if err := <-errs; err != nil && err != context.Canceled {
+		t.Fatal(err)
+	}
+
+	sql := c.CNRM.SqlV1beta1()
+	instance, err := sql.SQLInstances("default").Get(context.Background(), "uno", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "db-f1-micro", instance.Spec.Settings.Tier)
+	assert.Equal(t, "us-central1", *instance.Spec.Region)
+	assert.Equal(t, "MYSQL_8_0", *instance.Spec.DatabaseVersion)
+
+	database, err := sql.SQLDatabases("default").Get(context.Background(), "uno-db", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "uno", database.Spec.InstanceRef.Name)
+	assert.Equal(t, "utf8mb4", *database.Spec.Charset)
+	assert.Nil(t, database.Spec.Collation)
+
+	user, err := sql.SQLUsers("default").Get(context.Background(), "uno-user", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "uno", user.Spec.InstanceRef.Name)
+	require.NotNil(t, user.Spec.Password)
+	assert.Equal(t, "uno-user-password", user.Spec.Password.ValueFrom.SecretKeyRef.Name)
+	assert.Equal(t, "password", user.Spec.Password.ValueFrom.SecretKeyRef.Key)
+}
+
+func TestApplyNeedsTier(t *testing.T) {
+	c := k8stest.NewCluster("default")
+	m, err := k8s.LoadManifest(strings.NewReader(waitManifest))
+	require.NoError(t, err)
+
+	_, err = c.App().ApplyCloudSQL(context.Background(), m)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `instance "uno" needs a tier to be applied`)
+
+	_, err = c.CNRM.SqlV1beta1().SQLInstances("default").Get(context.Background(), "uno", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "nothing is applied")
+}
@@ -2,12 +2,15 @@ package k8s
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"log"
 
 	v1beta1 "github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/sql/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
 )
 
 func (app *Application) GetInstance(ctx context.Context, name string) (*v1beta1.SQLInstance, error) {
@@ -34,22 +37,138 @@ func (app *Application) GetInstanceList(ctx context.Context) (*v1beta1.SQLInstan
 	return list, nil
 }
 
-func (app *Application) WatchInstance(ctx context.Context, name string) {
-	watcher, err := app.cnrmClient.SqlV1beta1().
-		SQLInstances(app.namespace).
-		Watch(ctx, v1.ListOptions{FieldSelector: "metadata.name=" + name})
-	defer watcher.Stop()
+func (app *Application) GetDatabase(ctx context.Context, name string) (*v1beta1.SQLDatabase, error) {
+	return app.cnrmClient.SqlV1beta1().
+		SQLDatabases(app.namespace).
+		Get(ctx, name, v1.GetOptions{})
+}
+
+func (app *Application) GetDatabaseList(ctx context.Context) (*v1beta1.SQLDatabaseList, error) {
+	return app.cnrmClient.SqlV1beta1().
+		SQLDatabases(app.namespace).
+		List(ctx, v1.ListOptions{})
+}
+
+func (app *Application) GetUser(ctx context.Context, name string) (*v1beta1.SQLUser, error) {
+	return app.cnrmClient.SqlV1beta1().
+		SQLUsers(app.namespace).
+		Get(ctx, name, v1.GetOptions{})
+}
+
+func (app *Application) GetUserList(ctx context.Context) (*v1beta1.SQLUserList, error) {
+	return app.cnrmClient.SqlV1beta1().
+		SQLUsers(app.namespace).
+		List(ctx, v1.ListOptions{})
+}
+
+// InstanceChange is a change to a watched SQL instance. Err is set on the
+// last change sent when the watch fails; Instance is nil then.
+type InstanceChange struct {
+	Type      watch.EventType
+	Instance  *v1beta1.SQLInstance
+	Readiness Readiness
+	Err       error
+}
+
+// WatchInstance streams the changes to a SQL instance, starting with its
+// current state. A failure to start the watch is returned; a later one is
+// sent as a change with Err set, as is the watch ending before ctx does. The
+// channel is closed when ctx ends or after an error.
+func (app *Application) WatchInstance(ctx context.Context, name string) (<-chan InstanceChange, error) {
+	watcher, err := newListWatcher(ctx, app.instanceListWatch(ctx, name))
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
+	changes := make(chan InstanceChange)
+	go forwardInstanceChanges(ctx, watcher, name, changes)
+	return changes, nil
+}
+
+// forwardInstanceChanges sends the changes to the instance that watcher
+// sees until ctx ends or the watch fails, then closes changes. A watch that
+// ends on its own is a failure too, so the receiver doesn't take it for ctx
+// ending.
+func forwardInstanceChanges(ctx context.Context, watcher watch.Interface, name string, changes chan<- InstanceChange) {
+	defer close(changes)
+	defer watcher.Stop()
+	send := func(change InstanceChange) bool {
+		select {
+		case changes <- change:
+			return change.Err == nil
+		case <-ctx.Done():
+			return false
+		}
+	}
 	for {
 		select {
-		case e := <-watcher.ResultChan():
-			fmt.Printf("%#v\n", e)
+		case e, ok := <-watcher.ResultChan():
+			if !ok {
+				if ctx.Err() == nil {
+					send(InstanceChange{Err: fmt.Errorf("watch on %s %s ended", SqlResourceInstance, name)})
+				}
+				return
+			}
+			change, ok := instanceChange(e, name)
+			if ok && !send(change) {
+				return
+			}
 		case <-ctx.Done():
-			err := errors.New("context timeout")
-			log.Fatal(err)
+			return
+		}
+	}
+}
+
+// WatchInstanceFunc calls fn with each change to a SQL instance until ctx
+// ends, which isn't an error, or fn or the watch returns one.
+func (app *Application) WatchInstanceFunc(ctx context.Context, name string, fn func(InstanceChange) error) error {
+	changes, err := app.WatchInstance(ctx, name)
+	if err != nil {
+		return err
+	}
+	for change := range changes {
+		if change.Err != nil {
+			return change.Err
+		}
+		if err := fn(change); err != nil {
+			return err
 		}
 	}
-}
\ No newline at end of file
+	return nil
+}
+
+// instanceChange turns a watch event into a change, skipping bookmarks and
+// other instances, which fakes send as they ignore the field selector.
+func instanceChange(e watch.Event, name string) (InstanceChange, bool) {
+	switch e.Type {
+	case watch.Error:
+		return InstanceChange{Type: e.Type, Err: apierrors.FromObject(e.Object)}, true
+	case watch.Bookmark:
+		return InstanceChange{}, false
+	}
+	instance, ok := e.Object.(*v1beta1.SQLInstance)
+	if !ok {
+		return InstanceChange{Type: watch.Error, Err: fmt.Errorf("unexpected object %T", e.Object)}, true
+	}
+	if instance.Name != name {
+		return InstanceChange{}, false
+	}
+	readiness, _ := ObjectReadiness(instance)
+	return InstanceChange{Type: e.Type, Instance: instance, Readiness: readiness}, true
+}
+
+// instanceListWatch lists and watches a single SQL instance by name.
+func (app *Application) instanceListWatch(ctx context.Context, name string) *cache.ListWatch {
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", name).String()
+	instances := app.cnrmClient.SqlV1beta1().SQLInstances(app.namespace)
+	return &cache.ListWatch{
+		ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return instances.List(ctx, options)
+		},
+		WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return instances.Watch(ctx, options)
+		},
+	}
+}
@@ -0,0 +1,80 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	v1beta1 "github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/sql/v1beta1"
+	cnrmfake "github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestWatchInstanceEnded(t *testing.T) {
+	watcher := watch.NewFake()
+	changes := make(chan InstanceChange)
+	go forwardInstanceChanges(context.Background(), watcher, "uno", changes)
+
+	watcher.Add(&v1beta1.SQLInstance{ObjectMeta: metav1.ObjectMeta{Name: "uno"}})
+	change := <-changes
+	require.NoError(t, change.Err)
+	assert.Equal(t, "uno", change.Instance.Name)
+
+	watcher.Stop()
+	change, ok := <-changes
+	require.True(t, ok)
+	assert.EqualError(t, change.Err, "watch on SqlInstance uno ended")
+	_, ok = <-changes
+	assert.False(t, ok)
+}
+
+func TestWatchInstanceCanceled(t *testing.T) {
+	watcher := watch.NewFake()
+	changes := make(chan InstanceChange)
+	ctx, cancel := context.WithCancel(context.Background())
+	go forwardInstanceChanges(ctx, watcher, "uno", changes)
+
+	cancel()
+	watcher.Stop()
+	for change := range changes {
+		assert.NoError(t, change.Err)
+	}
+}
+
+func TestGetDatabasesAndUsers(t *testing.T) {
+	meta := func(name, namespace string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: namespace}
+	}
+	app := newTestApp("default", nil, cnrmfake.NewSimpleClientset(
+		&v1beta1.SQLDatabase{ObjectMeta: meta("uno-db", "default")},
+		&v1beta1.SQLDatabase{ObjectMeta: meta("dos-db", "default")},
+		&v1beta1.SQLDatabase{ObjectMeta: meta("tres-db", "other")},
+		&v1beta1.SQLUser{ObjectMeta: meta("uno-user", "default")},
+		&v1beta1.SQLUser{ObjectMeta: meta("tres-user", "other")},
+	), nil)
+	ctx := context.TODO()
+
+	db, err := app.GetDatabase(ctx, "uno-db")
+	require.NoError(t, err)
+	assert.Equal(t, "uno-db", db.Name)
+	_, err = app.GetDatabase(ctx, "tres-db")
+	assert.True(t, apierrors.IsNotFound(err), err)
+
+	dbs, err := app.GetDatabaseList(ctx)
+	require.NoError(t, err)
+	assert.Len(t, dbs.Items, 2)
+
+	user, err := app.GetUser(ctx, "uno-user")
+	require.NoError(t, err)
+	assert.Equal(t, "uno-user", user.Name)
+	_, err = app.GetUser(ctx, "tres-user")
+	assert.True(t, apierrors.IsNotFound(err), err)
+
+	users, err := app.GetUserList(ctx)
+	require.NoError(t, err)
+	require.Len(t, users.Items, 1)
+	assert.Equal(t, "uno-user", users.Items[0].Name)
+}
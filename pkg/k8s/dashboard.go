@@ -0,0 +1,349 @@
+package k8s
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+const (
+	dashboardRefresh = 100 * time.Millisecond
+	// dashboardWidth and dashboardHeight are used when the terminal size
+	// can't be read.
+	dashboardWidth  = 120
+	dashboardHeight = 40
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// isTerminal reports whether w writes to a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// dashboardPrinter keeps a tree of every group's instance, databases, users
+// and resources on screen, redrawing it in place as events come in. Groups
+// with failures are drawn first, then those still in progress, so what needs
+// attention stays visible when the tree doesn't fit.
+type dashboardPrinter struct {
+	w     io.Writer
+	style Style
+	size  func() (int, int)
+	now   func() time.Time
+
+	mu      sync.Mutex
+	started time.Time
+	groups  []*dashboardGroup
+	rows    map[string]*dashboardRow
+	frame   int
+	// lines is how many lines the last frame took, to move back over them.
+	lines int
+	stop  chan struct{}
+	// done is set once the report is printed, so that a tick that was
+	// already waiting for mu doesn't draw over it.
+	done bool
+}
+
+type dashboardGroup struct {
+	name string
+	// group is the group the rows are waited on in, nil for workloads.
+	group *SqlInstanceGroup
+	rows  []*dashboardRow
+}
+
+type dashboardRow struct {
+	kind    DependencyType
+	name    string
+	child   bool
+	state   ResourceState
+	reason  string
+	message string
+	// ended is set once the row reached a final state, freezing its elapsed
+	// time.
+	ended time.Time
+}
+
+func newDashboardPrinter(w io.Writer, style Style) *dashboardPrinter {
+	p := &dashboardPrinter{
+		w:     w,
+		style: style,
+		now:   time.Now,
+		rows:  make(map[string]*dashboardRow),
+		size:  func() (int, int) { return dashboardWidth, dashboardHeight },
+	}
+	if f, ok := w.(*os.File); ok {
+		p.size = func() (int, int) {
+			width, height, err := term.GetSize(int(f.Fd()))
+			if err != nil {
+				return dashboardWidth, dashboardHeight
+			}
+			return width, height
+		}
+	}
+	return p
+}
+
+func (p *dashboardPrinter) PrintEvent(e SqlInstanceGroupEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.started.IsZero() {
+		p.started = p.now()
+		p.stop = make(chan struct{})
+		go p.tick(p.stop)
+	}
+
+	row := p.row(e)
+	row.state = e.State
+	if e.Condition != nil {
+		row.reason = e.Condition.Reason
+		row.message = e.Condition.Message
+	}
+	if e.Error != nil {
+		row.message = e.Error.Message
+	}
+	if e.State != StatePending && row.ended.IsZero() {
+		row.ended = p.now()
+	}
+	return p.draw()
+}
+
+func (p *dashboardPrinter) PrintReport(r *WaitReport) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done = true
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+	if err := p.draw(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprint(p.w, "\n"+r.String())
+	return err
+}
+
+func (p *dashboardPrinter) tick(stop <-chan struct{}) {
+	ticker := time.NewTicker(dashboardRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.mu.Lock()
+			if p.done {
+				p.mu.Unlock()
+				return
+			}
+			p.frame++
+			_ = p.draw()
+			p.mu.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// row returns the row of the event's resource. The first event of a group
+// adds a row for each of its resources, so they show before they report.
+func (p *dashboardPrinter) row(e SqlInstanceGroupEvent) *dashboardRow {
+	key := reportKey(e)
+	if row, ok := p.rows[key]; ok {
+		return row
+	}
+
+	name := "workloads"
+	if e.Group != nil {
+		name = e.Group.Name
+		if e.Group.standalone {
+			name = "resources"
+		}
+	}
+	var group *dashboardGroup
+	for _, g := range p.groups {
+		if g.group == e.Group {
+			group = g
+		}
+	}
+	if group == nil {
+		group = &dashboardGroup{name: name, group: e.Group}
+		p.groups = append(p.groups, group)
+		if e.Group != nil {
+			for _, member := range groupMembers(e.Group) {
+				p.add(group, member)
+			}
+		}
+	}
+	if row, ok := p.rows[key]; ok {
+		return row
+	}
+	return p.add(group, e)
+}
+
+func (p *dashboardPrinter) add(group *dashboardGroup, e SqlInstanceGroupEvent) *dashboardRow {
+	row := &dashboardRow{
+		kind:  e.Type,
+		name:  e.Name,
+		child: e.Group == nil || e.Group.standalone || e.Type != SqlResourceInstance,
+		state: StatePending,
+	}
+	group.rows = append(group.rows, row)
+	p.rows[reportKey(e)] = row
+	return row
+}
+
+// groupMembers returns the base events of the instance and everything else
+// the group waits on, in the order they are drawn.
+func groupMembers(s *SqlInstanceGroup) []SqlInstanceGroupEvent {
+	var members []SqlInstanceGroupEvent
+	if !s.standalone {
+		members = append(members, s.baseEvent(SqlResourceInstance, s.Name, "", ""))
+	}
+	for _, db := range s.Databases {
+		members = append(members, s.baseEvent(SqlResourceDatabase, db.Name, db.Namespace, ""))
+	}
+	for _, user := range s.Users {
+		members = append(members, s.baseEvent(SqlResourceUser, user.Name, user.Namespace, ""))
+	}
+	for _, resource := range s.Resources {
+		members = append(members, s.baseEvent(resource.Kind, resource.Name, resource.Namespace, resource.Cluster))
+	}
+	return members
+}
+
+// rank orders failing groups before pending ones, and those before
+// groups that are done.
+func (g *dashboardGroup) rank() int {
+	rank := 2
+	for _, row := range g.rows {
+		switch {
+		case row.state != StatePending && row.state != StateReady:
+			return 0
+		case row.state == StatePending:
+			rank = 1
+		}
+	}
+	return rank
+}
+
+// draw moves the cursor back over the last frame and draws the next one.
+// p.mu must be held.
+func (p *dashboardPrinter) draw() error {
+	width, height := p.size()
+	lines := p.render(width, height-1)
+
+	str := strings.Builder{}
+	if p.lines > 0 {
+		fmt.Fprintf(&str, "\033[%dA", p.lines)
+	}
+	for _, line := range lines {
+		str.WriteString("\r\033[2K")
+		str.WriteString(line)
+		str.WriteString("\n")
+	}
+	str.WriteString("\033[J")
+	p.lines = len(lines)
+	_, err := io.WriteString(p.w, str.String())
+	return err
+}
+
+// render returns the lines of a frame, at most height of them, cut to
+// width. p.mu must be held.
+func (p *dashboardPrinter) render(width, height int) []string {
+	groups := append([]*dashboardGroup(nil), p.groups...)
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].rank() < groups[j].rank()
+	})
+
+	labelWidth, reasonWidth := 0, 0
+	for _, row := range p.rows {
+		labelWidth = max(labelWidth, utf8.RuneCountInString(row.label()))
+		reasonWidth = max(reasonWidth, len(row.displayReason()))
+	}
+	// room for the branch in front of children
+	labelWidth += 3
+
+	var lines []string
+	total, ready := 0, 0
+	for _, g := range groups {
+		if len(g.rows) > 0 && g.rows[0].child {
+			lines = append(lines, "  "+g.name)
+		}
+		for i, row := range g.rows {
+			total++
+			if row.state == StateReady {
+				ready++
+			}
+			branch := ""
+			switch {
+			case !row.child:
+			case i == len(g.rows)-1:
+				branch = "└─ "
+			default:
+				branch = "├─ "
+			}
+			lines = append(lines, p.renderRow(row, branch, labelWidth, reasonWidth, width))
+		}
+	}
+
+	header := fmt.Sprintf("%d of %d ready, %s elapsed", ready, total, p.now().Sub(p.started).Round(time.Second))
+	if height > 2 && len(lines) > height-1 {
+		hidden := len(lines) - (height - 2)
+		lines = append(lines[:height-2], fmt.Sprintf("… %d more", hidden))
+	}
+	return append([]string{header}, lines...)
+}
+
+// renderRow draws a row as its state icon, resource, reason and elapsed
+// time, followed by the message when it failed.
+func (p *dashboardPrinter) renderRow(row *dashboardRow, branch string, labelWidth, reasonWidth, width int) string {
+	end := row.ended
+	if end.IsZero() {
+		end = p.now()
+	}
+	elapsed := end.Sub(p.started).Round(time.Second)
+
+	icon := spinnerFrames[p.frame%len(spinnerFrames)]
+	switch row.state {
+	case StateReady:
+		icon = "✓"
+	case StateFailed, StateTimedOut:
+		icon = "✗"
+	case StateSkipped:
+		icon = "-"
+	}
+
+	text := fmt.Sprintf("%s %-*s %-*s %6s", icon, labelWidth, branch+row.label(), reasonWidth, row.displayReason(), elapsed)
+	if row.state != StatePending && row.state != StateReady && row.message != "" {
+		text += "  " + row.message
+	}
+	return p.style.Severity(StateSeverity(row.state), truncate(text, width))
+}
+
+// displayReason is the condition reason, or the state before there is one.
+func (row *dashboardRow) displayReason() string {
+	if row.reason == "" {
+		return string(row.state)
+	}
+	return row.reason
+}
+
+func (row *dashboardRow) label() string {
+	return fmt.Sprintf("%s/%s", row.kind, row.name)
+}
+
+// truncate cuts s to width runes, as a wrapped line would throw off the
+// count of lines to redraw.
+func truncate(s string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:width-1]) + "…"
+}
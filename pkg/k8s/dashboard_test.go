@@ -0,0 +1,102 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDashboardPrinter(t *testing.T) {
+	m, err := LoadManifest(strings.NewReader(`
+instances:
+- name: uno
+- name: dos
+databases:
+- name: uno-db
+  instanceName: uno
+users:
+- name: uno-user
+  instanceName: uno
+`))
+	require.NoError(t, err)
+	sig := NewSqlInstanceGroupList(context.TODO(), newTestApp("default", nil, nil, nil))
+	require.NoError(t, sig.InitGroupsFromManifest(m))
+
+	var out bytes.Buffer
+	p := newDashboardPrinter(&out, Style{})
+	start := time.Now()
+	now := start
+	p.now = func() time.Time { return now }
+
+	event := func(group string, t DependencyType, name string, state ResourceState, reason, message string) SqlInstanceGroupEvent {
+		e := sig.GetGroup(group).baseEvent(t, name, "", "")
+		e.State = state
+		e.Condition = &v1alpha1.Condition{Reason: reason, Message: message}
+		return e
+	}
+	require.NoError(t, p.PrintEvent(event("dos", SqlResourceInstance, "dos", StateReady, ReasonUpToDate, "")))
+	now = start.Add(5 * time.Second)
+	require.NoError(t, p.PrintEvent(event("uno", SqlResourceInstance, "uno", StateReady, ReasonUpToDate, "")))
+	now = start.Add(12 * time.Second)
+	require.NoError(t, p.PrintEvent(event("uno", SqlResourceDatabase, "uno-db", StateFailed, ReasonUpdateFailed, "quota exceeded")))
+	now = start.Add(20 * time.Second)
+
+	// the report stops the spinner, and a tick already waiting doesn't draw
+	// over it
+	require.NoError(t, p.PrintReport(&WaitReport{}))
+	assert.Nil(t, p.stop)
+	assert.True(t, p.done)
+	p.frame = 0
+
+	lines := p.render(80, 40)
+	// the group with a failure comes first, and pending rows keep counting
+	assert.Equal(t, []string{
+		"2 of 4 ready, 20s elapsed",
+		"✓ SqlInstance/uno       UpToDate         5s",
+		"✗ ├─ SqlDatabase/uno-db UpdateFailed    12s  quota exceeded",
+		"⠋ └─ SqlUser/uno-user   Pending         20s",
+		"✓ SqlInstance/dos       UpToDate         0s",
+	}, lines)
+
+	// rows that don't fit are counted instead
+	lines = p.render(30, 4)
+	assert.Len(t, lines, 4)
+	assert.Equal(t, "… 2 more", lines[3])
+	assert.LessOrEqual(t, len([]rune(lines[1])), 30)
+}
+
+func TestDashboardGroupsByNamespace(t *testing.T) {
+	m, err := LoadManifest(strings.NewReader(`
+instances:
+- name: uno
+  namespace: a
+- name: uno
+  namespace: b
+`))
+	require.NoError(t, err)
+	sig := NewSqlInstanceGroupList(context.TODO(), newTestApp("default", nil, nil, nil))
+	require.NoError(t, sig.InitGroupsFromManifest(m))
+
+	p := newDashboardPrinter(&bytes.Buffer{}, Style{})
+	for _, group := range sig.Groups {
+		e := group.baseEvent(SqlResourceInstance, group.Name, "", "")
+		e.State = StateReady
+		require.NoError(t, p.PrintEvent(e))
+	}
+	require.NoError(t, p.PrintReport(&WaitReport{}))
+
+	assert.Len(t, p.groups, 2)
+	assert.Len(t, p.rows, 2)
+}
+
+func TestDashboardFallsBackToText(t *testing.T) {
+	p, err := NewPrinter(OutputTUI, &bytes.Buffer{})
+	require.NoError(t, err)
+	assert.IsType(t, &textPrinter{}, p)
+}
@@ -20,4 +20,18 @@ func (app *Application) GetDeployment(ctx context.Context, name string) (*v1.Dep
 		return deploy, err
 	}
 	return deploy, nil
-}
\ No newline at end of file
+}
+
+func (app *Application) GetDeploymentList(ctx context.Context) (*v1.DeploymentList, error) {
+	var err error
+	var list *v1.DeploymentList
+	list, err = app.kubeClient.
+		AppsV1().
+		Deployments(app.namespace).
+		List(ctx,
+			metav1.ListOptions{})
+	if err != nil {
+		return list, err
+	}
+	return list, nil
+}
@@ -0,0 +1,350 @@
+package k8s
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultLogLines is how many log lines are attached to a failing container.
+const DefaultLogLines = 20
+
+// probeGracePeriod is how long a running container may take to become ready
+// before its readiness probe is taken to be failing, unless it has already
+// been restarted.
+const probeGracePeriod = 30 * time.Second
+
+// PodProblem classifies why a pod or container isn't ready.
+type PodProblem string
+
+const (
+	ProblemNone           PodProblem = ""
+	ProblemCrashLoop      PodProblem = "CrashLoopBackOff"
+	ProblemImagePull      PodProblem = "ImagePullBackOff"
+	ProblemOOMKilled      PodProblem = "OOMKilled"
+	ProblemUnschedulable  PodProblem = "Unschedulable"
+	ProblemProbeFailing   PodProblem = "ProbeFailing"
+	ProblemContainerError PodProblem = "ContainerError"
+	ProblemPending        PodProblem = "Pending"
+)
+
+// problemRank orders problems by how much they explain, so a pod is
+// summed up by its worst container.
+var problemRank = map[PodProblem]int{
+	ProblemNone:           0,
+	ProblemPending:        1,
+	ProblemProbeFailing:   2,
+	ProblemContainerError: 3,
+	ProblemCrashLoop:      4,
+	ProblemOOMKilled:      5,
+	ProblemImagePull:      6,
+	ProblemUnschedulable:  7,
+}
+
+// startingReasons only mean a container is on its way up.
+var startingReasons = map[string]bool{
+	"ContainerCreating": true,
+	"PodInitializing":   true,
+}
+
+var imagePullReasons = map[string]bool{
+	"ImagePullBackOff": true,
+	"ErrImagePull":     true,
+	"InvalidImageName": true,
+}
+
+// ContainerDiagnosis is what is wrong with a single container.
+type ContainerDiagnosis struct {
+	Name     string
+	Init     bool
+	Problem  PodProblem
+	Reason   string
+	Message  string
+	Restarts int32
+	ExitCode int32
+	// Logs holds the last lines the container logged, from its previous run
+	// when it has restarted. LogError is set instead when they couldn't be
+	// read.
+	Logs     []string
+	LogError string
+}
+
+// PodDiagnosis is what is wrong with a pod. Problem is that of its worst
+// container, or of the pod itself when it can't be scheduled.
+type PodDiagnosis struct {
+	Name       string
+	Namespace  string
+	Phase      corev1.PodPhase
+	Ready      bool
+	Problem    PodProblem
+	Message    string
+	Containers []ContainerDiagnosis
+}
+
+// DiagnosePod sorts out why a pod isn't ready from its status alone.
+func DiagnosePod(pod *corev1.Pod) PodDiagnosis {
+	d := PodDiagnosis{
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+		Phase:     pod.Status.Phase,
+		Ready:     podReady(pod) || pod.Status.Phase == corev1.PodSucceeded,
+	}
+	if d.Ready {
+		return d
+	}
+
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse {
+			d.Problem = ProblemUnschedulable
+			d.Message = c.Message
+			return d
+		}
+	}
+
+	for _, cs := range pod.Status.InitContainerStatuses {
+		if cd := diagnoseContainer(cs, true); cd.Problem != ProblemNone {
+			d.Containers = append(d.Containers, cd)
+		}
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cd := diagnoseContainer(cs, false); cd.Problem != ProblemNone {
+			d.Containers = append(d.Containers, cd)
+		}
+	}
+	for _, cd := range d.Containers {
+		if problemRank[cd.Problem] > problemRank[d.Problem] {
+			d.Problem = cd.Problem
+			d.Message = cd.summary()
+		}
+	}
+	if d.Problem == ProblemNone {
+		d.Problem = ProblemPending
+		d.Message = string(pod.Status.Phase)
+	}
+	return d
+}
+
+func diagnoseContainer(cs corev1.ContainerStatus, init bool) ContainerDiagnosis {
+	cd := ContainerDiagnosis{Name: cs.Name, Init: init, Restarts: cs.RestartCount}
+	last := cs.LastTerminationState.Terminated
+
+	switch {
+	case cs.State.Waiting != nil && !startingReasons[cs.State.Waiting.Reason]:
+		w := cs.State.Waiting
+		cd.Reason = w.Reason
+		cd.Message = w.Message
+		switch {
+		case imagePullReasons[w.Reason]:
+			cd.Problem = ProblemImagePull
+		case w.Reason == "CrashLoopBackOff" && last != nil && last.Reason == "OOMKilled":
+			cd.Problem = ProblemOOMKilled
+			cd.ExitCode = last.ExitCode
+		case w.Reason == "CrashLoopBackOff":
+			cd.Problem = ProblemCrashLoop
+			if last != nil {
+				cd.ExitCode = last.ExitCode
+			}
+		default:
+			cd.Problem = ProblemContainerError
+		}
+	case cs.State.Terminated != nil && cs.State.Terminated.Reason == "OOMKilled":
+		cd.Problem = ProblemOOMKilled
+		cd.Reason = cs.State.Terminated.Reason
+		cd.ExitCode = cs.State.Terminated.ExitCode
+	case cs.State.Terminated != nil && cs.State.Terminated.ExitCode != 0:
+		cd.Problem = ProblemContainerError
+		cd.Reason = cs.State.Terminated.Reason
+		cd.Message = cs.State.Terminated.Message
+		cd.ExitCode = cs.State.Terminated.ExitCode
+	case cs.State.Running != nil && !cs.Ready && !init && probeFailing(cs):
+		cd.Problem = ProblemProbeFailing
+		cd.Reason = "NotReady"
+		cd.Message = "readiness probe is failing"
+	case cs.State.Running != nil && !cs.Ready && !init:
+		cd.Problem = ProblemPending
+		cd.Reason = "Starting"
+	}
+	return cd
+}
+
+// probeFailing tells a running container that isn't ready because its
+// probes fail from one that is still starting: it has been restarted, or has
+// been running for longer than probeGracePeriod since its startup probe, if
+// any, passed.
+func probeFailing(cs corev1.ContainerStatus) bool {
+	switch {
+	case cs.RestartCount > 0:
+		return true
+	case cs.Started != nil && !*cs.Started:
+		return false
+	}
+	return time.Since(cs.State.Running.StartedAt.Time) > probeGracePeriod
+}
+
+// summary describes the problem in a line. Waiting containers read like
+// "container web is ImagePullBackOff".
+func (cd *ContainerDiagnosis) summary() string {
+	str := strings.Builder{}
+	str.WriteString("container ")
+	if cd.Init {
+		str.WriteString("init:")
+	}
+	str.WriteString(cd.Name)
+
+	switch cd.Problem {
+	case ProblemOOMKilled:
+		str.WriteString(" was OOMKilled")
+	case ProblemContainerError:
+		if cd.ExitCode != 0 {
+			fmt.Fprintf(&str, " terminated with %s (exit code %d)", cd.Reason, cd.ExitCode)
+		} else {
+			fmt.Fprintf(&str, " is %s", cd.Reason)
+		}
+	case ProblemProbeFailing:
+		str.WriteString(" is running but its readiness probe is failing")
+	case ProblemCrashLoop:
+		fmt.Fprintf(&str, " is %s (exit code %d)", cd.Reason, cd.ExitCode)
+	default:
+		fmt.Fprintf(&str, " is %s", cd.Reason)
+	}
+	if cd.Restarts > 0 {
+		fmt.Fprintf(&str, ", restarted %d times", cd.Restarts)
+	}
+	if cd.Message != "" && cd.Problem != ProblemProbeFailing {
+		str.WriteString(": ")
+		str.WriteString(cd.Message)
+	}
+	return str.String()
+}
+
+// hasRun reports whether the container has started at least once, so it has
+// logs worth reading.
+func (cd *ContainerDiagnosis) hasRun() bool {
+	switch cd.Problem {
+	case ProblemCrashLoop, ProblemOOMKilled, ProblemProbeFailing:
+		return true
+	case ProblemContainerError:
+		return cd.ExitCode != 0 || cd.Restarts > 0
+	}
+	return false
+}
+
+func (d *PodDiagnosis) String() string {
+	str := strings.Builder{}
+	fmt.Fprintf(&str, "pod %s: ", d.Name)
+	if d.Ready {
+		str.WriteString("ready")
+	} else {
+		str.WriteString(d.Message)
+	}
+	for _, cd := range d.Containers {
+		if cd.summary() != d.Message {
+			fmt.Fprintf(&str, "\n  %s", cd.summary())
+		}
+		if cd.LogError != "" {
+			fmt.Fprintf(&str, "\n  logs of %s unavailable: %s", cd.Name, cd.LogError)
+		}
+		if len(cd.Logs) > 0 {
+			fmt.Fprintf(&str, "\n  last %d log lines of %s:", len(cd.Logs), cd.Name)
+			for _, line := range cd.Logs {
+				fmt.Fprintf(&str, "\n    %s", line)
+			}
+		}
+	}
+	return str.String()
+}
+
+// DiagnoseOptions selects the pods to diagnose and how much of their logs
+// to read.
+type DiagnoseOptions struct {
+	// Selector is a label selector; all pods in the namespace when empty.
+	Selector string
+	// Names narrows the pods down to those named, if any.
+	Names []string
+	// LogLines is the number of log lines to attach to each failing
+	// container, DefaultLogLines when zero and none when negative.
+	LogLines int64
+}
+
+// DiagnosePods diagnoses the pods of a namespace, or those matching
+// opts.Selector and opts.Names, and reads the recent logs of their failing
+// containers. Named pods that don't exist are left out.
+func (app *Application) DiagnosePods(ctx context.Context, namespace string, opts DiagnoseOptions) ([]PodDiagnosis, error) {
+	if namespace == "" {
+		namespace = app.namespace
+	}
+	pods, err := app.kubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: opts.Selector})
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(opts.Names))
+	for _, name := range opts.Names {
+		wanted[name] = true
+	}
+	diagnoses := make([]PodDiagnosis, 0, len(pods.Items))
+	for i := range pods.Items {
+		if len(wanted) > 0 && !wanted[pods.Items[i].Name] {
+			continue
+		}
+		d := DiagnosePod(&pods.Items[i])
+		app.attachLogs(ctx, &d, opts.LogLines, len(d.Containers))
+		diagnoses = append(diagnoses, d)
+	}
+	return diagnoses, nil
+}
+
+// attachLogs reads the last lines of at most limit failing containers that
+// have run, from their previous run when they have restarted and aren't
+// running now. It returns how many containers it read the logs of.
+func (app *Application) attachLogs(ctx context.Context, d *PodDiagnosis, lines int64, limit int) int {
+	if lines == 0 {
+		lines = DefaultLogLines
+	}
+	if lines < 0 {
+		return 0
+	}
+	read := 0
+	for i := range d.Containers {
+		cd := &d.Containers[i]
+		if !cd.hasRun() {
+			continue
+		}
+		if read == limit {
+			break
+		}
+		read++
+		previous := cd.Restarts > 0 && cd.Problem != ProblemProbeFailing
+		logs, err := app.containerLogs(ctx, d.Namespace, d.Name, cd.Name, previous, lines)
+		if err != nil {
+			cd.LogError = err.Error()
+			continue
+		}
+		cd.Logs = logs
+	}
+	return read
+}
+
+func (app *Application) containerLogs(ctx context.Context, namespace, pod, container string, previous bool, lines int64) ([]string, error) {
+	data, err := app.kubeClient.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{
+		Container: container,
+		Previous:  previous,
+		TailLines: &lines,
+	}).DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		logs = append(logs, scanner.Text())
+	}
+	return logs, scanner.Err()
+}
@@ -0,0 +1,213 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func testPod(name string, containers ...corev1.ContainerStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: containers},
+	}
+}
+
+func waiting(name, reason string, restarts int32, last *corev1.ContainerStateTerminated) corev1.ContainerStatus {
+	cs := corev1.ContainerStatus{
+		Name:         name,
+		RestartCount: restarts,
+		State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}},
+	}
+	if last != nil {
+		cs.LastTerminationState.Terminated = last
+	}
+	return cs
+}
+
+// running returns a container that isn't ready and has been running for
+// the given time.
+func running(name string, restarts int32, since time.Duration) corev1.ContainerStatus {
+	return corev1.ContainerStatus{
+		Name:         name,
+		RestartCount: restarts,
+		State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{
+			StartedAt: metav1.NewTime(time.Now().Add(-since)),
+		}},
+	}
+}
+
+// newTestKubeApp returns an application on a fake clientset holding objects.
+// The fake can't be watched from a list, so it only serves lookups.
+func newTestKubeApp(objects ...runtime.Object) (*Application, *kubefake.Clientset) {
+	kube := kubefake.NewSimpleClientset(objects...)
+	return newTestApp("default", kube, nil, nil), kube
+}
+
+func TestDiagnosePod(t *testing.T) {
+	tests := []struct {
+		name    string
+		pod     *corev1.Pod
+		problem PodProblem
+		message string
+	}{
+		{
+			name:    "crash loop",
+			pod:     testPod("a", waiting("web", "CrashLoopBackOff", 4, &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 1})),
+			problem: ProblemCrashLoop,
+			message: "container web is CrashLoopBackOff (exit code 1), restarted 4 times",
+		},
+		{
+			name:    "oom killed",
+			pod:     testPod("b", waiting("web", "CrashLoopBackOff", 2, &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137})),
+			problem: ProblemOOMKilled,
+			message: "container web was OOMKilled, restarted 2 times",
+		},
+		{
+			name:    "image pull",
+			pod:     testPod("c", waiting("web", "ImagePullBackOff", 0, nil)),
+			problem: ProblemImagePull,
+			message: "container web is ImagePullBackOff",
+		},
+		{
+			name:    "probe failing",
+			pod:     testPod("d", running("web", 0, time.Hour)),
+			problem: ProblemProbeFailing,
+			message: "container web is running but its readiness probe is failing",
+		},
+		{
+			name:    "probe failing after a restart",
+			pod:     testPod("d", running("web", 1, time.Second)),
+			problem: ProblemProbeFailing,
+			message: "container web is running but its readiness probe is failing, restarted 1 times",
+		},
+		{
+			name:    "starting",
+			pod:     testPod("d", running("web", 0, time.Second)),
+			problem: ProblemPending,
+			message: "container web is Starting",
+		},
+		{
+			name: "unschedulable",
+			pod: &corev1.Pod{Status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+				Conditions: []corev1.PodCondition{{
+					Type:    corev1.PodScheduled,
+					Status:  corev1.ConditionFalse,
+					Message: "0/3 nodes are available: 3 Insufficient memory.",
+				}},
+			}},
+			problem: ProblemUnschedulable,
+			message: "0/3 nodes are available: 3 Insufficient memory.",
+		},
+		{
+			name:    "pending",
+			pod:     &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending}},
+			problem: ProblemPending,
+			message: "Pending",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := DiagnosePod(tt.pod)
+			assert.False(t, d.Ready)
+			assert.Equal(t, tt.problem, d.Problem)
+			assert.Equal(t, tt.message, d.Message)
+		})
+	}
+}
+
+func TestDiagnosePods(t *testing.T) {
+	ready := testPod("ready", corev1.ContainerStatus{Name: "web", Ready: true})
+	ready.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	crashing := testPod("crashing", waiting("web", "CrashLoopBackOff", 3, &corev1.ContainerStateTerminated{ExitCode: 1}))
+	pulling := testPod("pulling", waiting("web", "ErrImagePull", 0, nil))
+	app, _ := newTestKubeApp(ready, crashing, pulling)
+
+	diagnoses, err := app.DiagnosePods(context.TODO(), "", DiagnoseOptions{Selector: "app=web"})
+	require.NoError(t, err)
+	require.Len(t, diagnoses, 3)
+
+	byName := make(map[string]*PodDiagnosis)
+	for i := range diagnoses {
+		byName[diagnoses[i].Name] = &diagnoses[i]
+	}
+	assert.True(t, byName["ready"].Ready)
+	// The fake clientset returns "fake logs" for any container.
+	assert.Equal(t, []string{"fake logs"}, byName["crashing"].Containers[0].Logs)
+	assert.Contains(t, byName["crashing"].String(), "last 1 log lines of web:\n    fake logs")
+	assert.Empty(t, byName["pulling"].Containers[0].Logs, "a container that never started has no logs")
+}
+
+func TestDiagnosePodsByName(t *testing.T) {
+	crashing := testPod("crashing", waiting("web", "CrashLoopBackOff", 3, &corev1.ContainerStateTerminated{ExitCode: 1}))
+	other := testPod("other", waiting("web", "CrashLoopBackOff", 3, &corev1.ContainerStateTerminated{ExitCode: 1}))
+	app, kube := newTestKubeApp(crashing, other)
+
+	diagnoses, err := app.DiagnosePods(context.TODO(), "", DiagnoseOptions{Names: []string{"crashing", "missing"}})
+	require.NoError(t, err)
+	require.Len(t, diagnoses, 1)
+	assert.Equal(t, "crashing", diagnoses[0].Name)
+
+	logsRead := 0
+	for _, action := range kube.Actions() {
+		if action.GetSubresource() == "log" {
+			logsRead++
+		}
+	}
+	assert.Equal(t, 1, logsRead, "only the logs of the named pod are read")
+}
+
+func TestPodHoldupsLogs(t *testing.T) {
+	owner := &metav1.ObjectMeta{Name: "web-abc", UID: "rs-uid"}
+	ref := *metav1.NewControllerRef(owner, appsv1.SchemeGroupVersion.WithKind("ReplicaSet"))
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	previousLogs := func(kube *kubefake.Clientset) []bool {
+		var previous []bool
+		for _, action := range kube.Actions() {
+			if generic, ok := action.(clienttesting.GenericAction); ok && action.GetSubresource() == "log" {
+				previous = append(previous, generic.GetValue().(*corev1.PodLogOptions).Previous)
+			}
+		}
+		return previous
+	}
+
+	// the logs of only a few crashing containers are read, from their
+	// previous run
+	var objects []runtime.Object
+	for i := 0; i < holdupLogContainers+2; i++ {
+		pod := testPod(fmt.Sprintf("crashing-%d", i), waiting("web", "CrashLoopBackOff", 3, &corev1.ContainerStateTerminated{ExitCode: 1}))
+		pod.OwnerReferences = []metav1.OwnerReference{ref}
+		objects = append(objects, pod)
+	}
+	app, kube := newTestKubeApp(objects...)
+	holdups := app.podHoldups(context.TODO(), "default", selector, owner)
+	require.Len(t, holdups, holdupLogContainers+2)
+	logged := 0
+	for _, holdup := range holdups {
+		if len(holdup.Logs) > 0 {
+			logged++
+		}
+	}
+	assert.Equal(t, holdupLogContainers, logged)
+	assert.Equal(t, []bool{true, true, true, true, true}, previousLogs(kube))
+
+	// a container that restarted but is running now has the logs of its
+	// current run read
+	probing := testPod("probing", running("web", 2, time.Hour))
+	probing.OwnerReferences = []metav1.OwnerReference{ref}
+	app, kube = newTestKubeApp(probing)
+	holdups = app.podHoldups(context.TODO(), "default", selector, owner)
+	require.Len(t, holdups, 1)
+	assert.Equal(t, []bool{false}, previousLogs(kube))
+}
@@ -0,0 +1,346 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
+	v1beta1 "github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/sql/v1beta1"
+)
+
+type DiffKind string
+
+const (
+	// DiffMissing is in the manifest but not in the cluster.
+	DiffMissing DiffKind = "Missing"
+	// DiffOrphaned is a database or user of an instance in the manifest that
+	// the manifest doesn't list.
+	DiffOrphaned DiffKind = "Orphaned"
+	// DiffDrifted is in both, with spec fields that differ.
+	DiffDrifted DiffKind = "Drifted"
+)
+
+// FieldDrift is a spec field whose live value isn't the one the manifest
+// sets.
+type FieldDrift struct {
+	Field string `json:"field"`
+	Want  string `json:"want"`
+	Have  string `json:"have"`
+}
+
+// ResourceDiff is a resource that differs between the manifest and the
+// cluster.
+type ResourceDiff struct {
+	Diff      DiffKind       `json:"diff"`
+	Group     string         `json:"group"`
+	Cluster   string         `json:"cluster,omitempty"`
+	Namespace string         `json:"namespace"`
+	Type      DependencyType `json:"type"`
+	Name      string         `json:"name"`
+	// Fields are the drifted fields.
+	Fields []FieldDrift `json:"fields,omitempty"`
+}
+
+// ManifestDiff is what DiffCloudSQL found, in the order of the manifest with
+// orphans last.
+type ManifestDiff struct {
+	Resources []ResourceDiff `json:"resources"`
+}
+
+func (d *ManifestDiff) Empty() bool {
+	return len(d.Resources) == 0
+}
+
+func (d *ManifestDiff) String() string {
+	if d.Empty() {
+		return "no differences\n"
+	}
+	str := strings.Builder{}
+	for _, r := range d.Resources {
+		location := r.Namespace + "/" + r.Name
+		if r.Cluster != "" {
+			location += " in cluster " + r.Cluster
+		}
+		switch r.Diff {
+		case DiffMissing:
+			fmt.Fprintf(&str, "+ %s %s: missing\n", r.Type, location)
+		case DiffOrphaned:
+			fmt.Fprintf(&str, "- %s %s: orphaned, belongs to instance %s\n", r.Type, location, r.Group)
+		case DiffDrifted:
+			fmt.Fprintf(&str, "~ %s %s: drifted\n", r.Type, location)
+			for _, field := range r.Fields {
+				fmt.Fprintf(&str, "    %s: %q in the cluster, %q in the manifest\n", field.Field, field.Have, field.Want)
+			}
+		}
+	}
+	return str.String()
+}
+
+// liveSQL holds the SQL resources of one namespace of a cluster.
+type liveSQL struct {
+	cluster   string
+	namespace string
+	instances *v1beta1.SQLInstanceList
+	databases *v1beta1.SQLDatabaseList
+	users     *v1beta1.SQLUserList
+}
+
+// DiffCloudSQL compares the SQL instances, databases and users of the
+// manifest with those in the cluster without changing anything. Orphans are
+// only looked for in the namespaces the manifest uses: a database or user
+// whose instanceRef.namespace points at an instance of the manifest from
+// another namespace is found when it is in one of them, and missed
+// otherwise. Other resources and workloads aren't compared.
+func (app *Application) DiffCloudSQL(ctx context.Context, manifest *SqlManifest) (*ManifestDiff, error) {
+	groups := NewSqlInstanceGroupList(ctx, app)
+	if err := groups.InitGroupsFromManifest(manifest); err != nil {
+		return nil, err
+	}
+
+	var lives []*liveSQL
+	fetch := func(cluster, namespace string) (*liveSQL, error) {
+		for _, live := range lives {
+			if live.cluster == cluster && live.namespace == namespace {
+				return live, nil
+			}
+		}
+		clusterApp, err := app.Cluster(cluster)
+		if err != nil {
+			return nil, err
+		}
+		nsApp := clusterApp.inNamespace(namespace)
+		live := &liveSQL{cluster: cluster, namespace: namespace}
+		if live.instances, err = nsApp.GetInstanceList(ctx); err != nil {
+			return nil, fmt.Errorf("list SQLInstances: %w", err)
+		}
+		if live.databases, err = nsApp.GetDatabaseList(ctx); err != nil {
+			return nil, fmt.Errorf("list SQLDatabases: %w", err)
+		}
+		if live.users, err = nsApp.GetUserList(ctx); err != nil {
+			return nil, fmt.Errorf("list SQLUsers: %w", err)
+		}
+		lives = append(lives, live)
+		return live, nil
+	}
+
+	diff := &ManifestDiff{Resources: make([]ResourceDiff, 0)}
+	for _, g := range groups.Groups {
+		add := func(kind DiffKind, t DependencyType, namespace, name string, fields []FieldDrift) {
+			if kind == DiffDrifted && len(fields) == 0 {
+				return
+			}
+			diff.Resources = append(diff.Resources, ResourceDiff{
+				Diff:      kind,
+				Group:     g.Name,
+				Cluster:   g.Cluster,
+				Namespace: namespace,
+				Type:      t,
+				Name:      name,
+				Fields:    fields,
+			})
+		}
+
+		want := g.instanceObject()
+		live, err := fetch(g.Cluster, want.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		if have := findInstance(live.instances, want.Name); have == nil {
+			add(DiffMissing, SqlResourceInstance, want.Namespace, want.Name, nil)
+		} else {
+			add(DiffDrifted, SqlResourceInstance, want.Namespace, want.Name, instanceDrift(want, have))
+		}
+
+		for _, db := range g.Databases {
+			want := g.databaseObject(db)
+			live, err := fetch(g.Cluster, want.Namespace)
+			if err != nil {
+				return nil, err
+			}
+			if have := findDatabase(live.databases, want.Name); have == nil {
+				add(DiffMissing, SqlResourceDatabase, want.Namespace, want.Name, nil)
+			} else {
+				add(DiffDrifted, SqlResourceDatabase, want.Namespace, want.Name, databaseDrift(want, have))
+			}
+		}
+
+		for _, u := range g.Users {
+			want := g.userObject(u)
+			live, err := fetch(g.Cluster, want.Namespace)
+			if err != nil {
+				return nil, err
+			}
+			if have := findUser(live.users, want.Name); have == nil {
+				add(DiffMissing, SqlResourceUser, want.Namespace, want.Name, nil)
+			} else {
+				add(DiffDrifted, SqlResourceUser, want.Namespace, want.Name, userDrift(want, have))
+			}
+		}
+	}
+
+	for _, live := range lives {
+		for _, db := range live.databases.Items {
+			g := groups.refGroup(live.cluster, live.namespace, db.Spec.InstanceRef.Name, db.Spec.InstanceRef.Namespace)
+			if g != nil && !g.listsDatabase(db.Name, live.namespace) {
+				diff.Resources = append(diff.Resources, g.orphan(SqlResourceDatabase, live.namespace, db.Name))
+			}
+		}
+		for _, user := range live.users.Items {
+			g := groups.refGroup(live.cluster, live.namespace, user.Spec.InstanceRef.Name, user.Spec.InstanceRef.Namespace)
+			if g != nil && !g.listsUser(user.Name, live.namespace) {
+				diff.Resources = append(diff.Resources, g.orphan(SqlResourceUser, live.namespace, user.Name))
+			}
+		}
+	}
+	return diff, nil
+}
+
+// inNamespace returns a copy of the application, on the same clients and
+// with the same logger, metrics, timeouts and clusters, whose getters look in
+// namespace.
+func (app *Application) inNamespace(namespace string) *Application {
+	if namespace == app.namespace {
+		return app
+	}
+	ns := &Application{
+		restConfig: app.restConfig,
+		kubeClient: app.kubeClient,
+		cnrmClient: app.cnrmClient,
+		dynClient:  app.dynClient,
+		namespace:  namespace,
+		printer:    app.printer,
+		logger:     app.logger,
+		metrics:    app.metrics,
+		timeouts:   app.timeouts,
+		opts:       app.opts,
+		clusters:   make(map[string]*Application),
+	}
+	app.clustersMu.Lock()
+	defer app.clustersMu.Unlock()
+	for name, cluster := range app.clusters {
+		ns.clusters[name] = cluster
+	}
+	return ns
+}
+
+// refGroup returns the group of the instance an instanceRef in namespace
+// points at, or nil when it isn't in the manifest.
+func (s *SqlInstanceGroupList) refGroup(cluster, namespace, name, refNamespace string) *SqlInstanceGroup {
+	if refNamespace != "" {
+		namespace = refNamespace
+	}
+	for _, g := range s.Groups {
+		if g.Name == name && g.Cluster == cluster && g.namespaceFor("") == namespace {
+			return g
+		}
+	}
+	return nil
+}
+
+func (g *SqlInstanceGroup) listsDatabase(name, namespace string) bool {
+	for _, db := range g.Databases {
+		if db.Name == name && g.namespaceFor(db.Namespace) == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *SqlInstanceGroup) listsUser(name, namespace string) bool {
+	for _, user := range g.Users {
+		if user.Name == name && g.namespaceFor(user.Namespace) == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *SqlInstanceGroup) orphan(t DependencyType, namespace, name string) ResourceDiff {
+	return ResourceDiff{
+		Diff:      DiffOrphaned,
+		Group:     g.Name,
+		Cluster:   g.Cluster,
+		Namespace: namespace,
+		Type:      t,
+		Name:      name,
+	}
+}
+
+func findInstance(list *v1beta1.SQLInstanceList, name string) *v1beta1.SQLInstance {
+	for i := range list.Items {
+		if list.Items[i].Name == name {
+			return &list.Items[i]
+		}
+	}
+	return nil
+}
+
+func findDatabase(list *v1beta1.SQLDatabaseList, name string) *v1beta1.SQLDatabase {
+	for i := range list.Items {
+		if list.Items[i].Name == name {
+			return &list.Items[i]
+		}
+	}
+	return nil
+}
+
+func findUser(list *v1beta1.SQLUserList, name string) *v1beta1.SQLUser {
+	for i := range list.Items {
+		if list.Items[i].Name == name {
+			return &list.Items[i]
+		}
+	}
+	return nil
+}
+
+// drift collects the fields whose live value differs. Fields the manifest
+// leaves empty are whatever the cluster says they are.
+type drift []FieldDrift
+
+func (d *drift) compare(field, want, have string) {
+	if want != "" && want != have {
+		*d = append(*d, FieldDrift{Field: field, Want: want, Have: have})
+	}
+}
+
+func instanceDrift(want, have *v1beta1.SQLInstance) []FieldDrift {
+	var d drift
+	d.compare("spec.settings.tier", want.Spec.Settings.Tier, have.Spec.Settings.Tier)
+	d.compare("spec.region", deref(want.Spec.Region), deref(have.Spec.Region))
+	d.compare("spec.databaseVersion", deref(want.Spec.DatabaseVersion), deref(have.Spec.DatabaseVersion))
+	return d
+}
+
+func databaseDrift(want, have *v1beta1.SQLDatabase) []FieldDrift {
+	var d drift
+	d.compare("spec.instanceRef.name", want.Spec.InstanceRef.Name, have.Spec.InstanceRef.Name)
+	d.compare("spec.instanceRef.namespace", want.Spec.InstanceRef.Namespace, have.Spec.InstanceRef.Namespace)
+	d.compare("spec.charset", deref(want.Spec.Charset), deref(have.Spec.Charset))
+	d.compare("spec.collation", deref(want.Spec.Collation), deref(have.Spec.Collation))
+	return d
+}
+
+func userDrift(want, have *v1beta1.SQLUser) []FieldDrift {
+	var d drift
+	d.compare("spec.instanceRef.name", want.Spec.InstanceRef.Name, have.Spec.InstanceRef.Name)
+	d.compare("spec.instanceRef.namespace", want.Spec.InstanceRef.Namespace, have.Spec.InstanceRef.Namespace)
+	wantRef, haveRef := passwordSecretRef(want), passwordSecretRef(have)
+	d.compare("spec.password.valueFrom.secretKeyRef.name", wantRef.Name, haveRef.Name)
+	d.compare("spec.password.valueFrom.secretKeyRef.key", wantRef.Key, haveRef.Key)
+	return d
+}
+
+func passwordSecretRef(u *v1beta1.SQLUser) v1alpha1.SecretKeyRef {
+	if p := u.Spec.Password; p != nil && p.ValueFrom != nil && p.ValueFrom.SecretKeyRef != nil {
+		return *p.ValueFrom.SecretKeyRef
+	}
+	return v1alpha1.SecretKeyRef{}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
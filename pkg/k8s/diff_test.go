@@ -0,0 +1,88 @@
+package k8s_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/chrisbradleydev/go-k8s/pkg/k8s"
+	"github.com/chrisbradleydev/go-k8s/pkg/k8s/k8stest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	c := k8stest.NewCluster("default")
+	require.NoError(t, c.Create(k8s.SqlResourceInstance, "uno", map[string]interface{}{
+		"region":          "us-central1",
+		"databaseVersion": "MYSQL_8_0",
+		"settings":        map[string]interface{}{"tier": "db-g1-small"},
+	}))
+	require.NoError(t, c.Create(k8s.SqlResourceDatabase, "uno-db", map[string]interface{}{
+		"instanceRef": map[string]interface{}{"name": "uno"},
+		"charset":     "utf8mb4",
+	}))
+	require.NoError(t, c.AddUser("stray", "uno"))
+	require.NoError(t, c.AddUser("other-user", "dos"))
+
+	m, err := k8s.LoadManifest(strings.NewReader(applyManifest))
+	require.NoError(t, err)
+	diff, err := c.App().DiffCloudSQL(context.Background(), m)
+	require.NoError(t, err)
+
+	assert.Equal(t, []k8s.ResourceDiff{
+		{
+			Diff: k8s.DiffDrifted, Group: "uno", Namespace: "default", Type: k8s.SqlResourceInstance, Name: "uno",
+			Fields: []k8s.FieldDrift{{Field: "spec.settings.tier", Want: "db-f1-micro", Have: "db-g1-small"}},
+		},
+		{Diff: k8s.DiffMissing, Group: "uno", Namespace: "default", Type: k8s.SqlResourceUser, Name: "uno-user"},
+		{Diff: k8s.DiffOrphaned, Group: "uno", Namespace: "default", Type: k8s.SqlResourceUser, Name: "stray"},
+	}, diff.Resources)
+
+	assert.Equal(t, `~ SqlInstance default/uno: drifted
+    spec.settings.tier: "db-g1-small" in the cluster, "db-f1-micro" in the manifest
++ SqlUser default/uno-user: missing
+- SqlUser default/stray: orphaned, belongs to instance uno
+`, diff.String())
+
+	out, err := json.Marshal(diff)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `{"diff":"Missing","group":"uno","namespace":"default","type":"SqlUser","name":"uno-user"}`)
+}
+
+func TestDiffNone(t *testing.T) {
+	c, m := newTestCluster(t)
+
+	diff, err := c.App().DiffCloudSQL(context.Background(), m)
+	require.NoError(t, err)
+	assert.True(t, diff.Empty(), diff.String())
+	assert.Equal(t, "no differences\n", diff.String())
+}
+
+func TestDiffCrossNamespaceOrphans(t *testing.T) {
+	c := k8stest.NewCluster("default")
+	require.NoError(t, c.AddInstance("uno"))
+	ref := map[string]interface{}{"instanceRef": map[string]interface{}{"name": "uno", "namespace": "default"}}
+	team, other := c.InNamespace("team"), c.InNamespace("other")
+	require.NoError(t, team.Create(k8s.SqlResourceDatabase, "uno-db", ref))
+	require.NoError(t, team.Create(k8s.SqlResourceDatabase, "stray-db", ref))
+	// no database of the manifest is in other, so it isn't looked in
+	require.NoError(t, other.Create(k8s.SqlResourceDatabase, "lost-db", ref))
+
+	m, err := k8s.LoadManifest(strings.NewReader(`
+instances:
+- name: uno
+databases:
+- name: uno-db
+  instanceName: uno
+  namespace: team
+`))
+	require.NoError(t, err)
+	diff, err := c.App().DiffCloudSQL(context.Background(), m)
+	require.NoError(t, err)
+
+	assert.Equal(t, []k8s.ResourceDiff{
+		{Diff: k8s.DiffOrphaned, Group: "uno", Namespace: "team", Type: k8s.SqlResourceDatabase, Name: "stray-db"},
+	}, diff.Resources)
+}
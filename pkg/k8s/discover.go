@@ -0,0 +1,100 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// DiscoverManifest builds a manifest from the SQLInstances, SQLDatabases and
+// SQLUsers in the namespace that match the label selector. An empty selector
+// matches everything. Databases and users are grouped by spec.instanceRef, so
+// an instance is included when any of its children match even if the
+// instance itself isn't labeled, and every database and user of an included
+// instance is waited on with it, labeled or not.
+func (app *Application) DiscoverManifest(ctx context.Context, selector string) (*SqlManifest, error) {
+	matches, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector %q: %w", selector, err)
+	}
+	sql := app.cnrmClient.SqlV1beta1()
+
+	instanceList, err := sql.SQLInstances(app.namespace).List(ctx, v1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("list SQLInstances: %w", err)
+	}
+	// children are listed whole, so that those of a matching instance are
+	// found without the label
+	databaseList, err := sql.SQLDatabases(app.namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list SQLDatabases: %w", err)
+	}
+	userList, err := sql.SQLUsers(app.namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list SQLUsers: %w", err)
+	}
+
+	instances := make(map[string]bool)
+	for _, instance := range instanceList.Items {
+		instances[instance.Name] = true
+	}
+	for _, database := range databaseList.Items {
+		if instanceName, ok := app.instanceRefName(database.Spec.InstanceRef); ok && matches.Matches(labels.Set(database.Labels)) {
+			instances[instanceName] = true
+		}
+	}
+	for _, user := range userList.Items {
+		if instanceName, ok := app.instanceRefName(user.Spec.InstanceRef); ok && matches.Matches(labels.Set(user.Labels)) {
+			instances[instanceName] = true
+		}
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no SQL resources found in namespace %q matching selector %q", app.namespace, selector)
+	}
+
+	m := &SqlManifest{}
+	for _, database := range databaseList.Items {
+		if instanceName, ok := app.instanceRefName(database.Spec.InstanceRef); ok && instances[instanceName] {
+			m.Databases = append(m.Databases, SqlDatabase{Name: database.Name, InstanceName: instanceName})
+		}
+	}
+	for _, user := range userList.Items {
+		if instanceName, ok := app.instanceRefName(user.Spec.InstanceRef); ok && instances[instanceName] {
+			m.Users = append(m.Users, SqlUser{Name: user.Name, InstanceName: instanceName})
+		}
+	}
+	for name := range instances {
+		m.Instances = append(m.Instances, SqlInstance{Name: name})
+	}
+	sort.Slice(m.Instances, func(i, j int) bool { return m.Instances[i].Name < m.Instances[j].Name })
+	sort.Slice(m.Databases, func(i, j int) bool { return m.Databases[i].Name < m.Databases[j].Name })
+	sort.Slice(m.Users, func(i, j int) bool { return m.Users[i].Name < m.Users[j].Name })
+
+	return m, m.Validate()
+}
+
+// Discover populates the group list from the resources found in the cluster.
+func (s *SqlInstanceGroupList) Discover(selector string) error {
+	m, err := s.app.DiscoverManifest(s.ctx, selector)
+	if err != nil {
+		return err
+	}
+	return s.InitGroupsFromManifest(m)
+}
+
+// instanceRefName returns the name of the SQLInstance a child resource points
+// at. References by external name, or to another namespace, can't be watched
+// and are skipped.
+func (app *Application) instanceRefName(ref v1alpha1.ResourceRef) (string, bool) {
+	if ref.Name == "" {
+		return "", false
+	}
+	if ref.Namespace != "" && ref.Namespace != app.namespace {
+		return "", false
+	}
+	return ref.Name, true
+}
@@ -0,0 +1,85 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
+	sqlv1beta1 "github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/sql/v1beta1"
+	cnrmfake "github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func discoverMeta(name, namespace string, labels map[string]string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}
+}
+
+func TestDiscoverManifest(t *testing.T) {
+	team := map[string]string{"team": "payments"}
+	client := cnrmfake.NewSimpleClientset(
+		&sqlv1beta1.SQLInstance{ObjectMeta: discoverMeta("uno", "default", team)},
+		&sqlv1beta1.SQLInstance{ObjectMeta: discoverMeta("dos", "default", nil)},
+		&sqlv1beta1.SQLInstance{ObjectMeta: discoverMeta("tres", "other", team)},
+		&sqlv1beta1.SQLDatabase{
+			ObjectMeta: discoverMeta("uno-db", "default", team),
+			Spec:       sqlv1beta1.SQLDatabaseSpec{InstanceRef: v1alpha1.ResourceRef{Name: "uno"}},
+		},
+		// the instance is included through its labeled database
+		&sqlv1beta1.SQLDatabase{
+			ObjectMeta: discoverMeta("dos-db", "default", team),
+			Spec:       sqlv1beta1.SQLDatabaseSpec{InstanceRef: v1alpha1.ResourceRef{Name: "dos"}},
+		},
+		// references to another namespace can't be watched
+		&sqlv1beta1.SQLDatabase{
+			ObjectMeta: discoverMeta("tres-db", "default", team),
+			Spec:       sqlv1beta1.SQLDatabaseSpec{InstanceRef: v1alpha1.ResourceRef{Name: "tres", Namespace: "other"}},
+		},
+		&sqlv1beta1.SQLUser{
+			ObjectMeta: discoverMeta("uno-user", "default", team),
+			Spec:       sqlv1beta1.SQLUserSpec{InstanceRef: v1alpha1.ResourceRef{Name: "uno"}},
+		},
+		// unlabeled children of an included instance are waited on with it
+		&sqlv1beta1.SQLUser{
+			ObjectMeta: discoverMeta("uno-reader", "default", nil),
+			Spec:       sqlv1beta1.SQLUserSpec{InstanceRef: v1alpha1.ResourceRef{Name: "uno"}},
+		},
+		&sqlv1beta1.SQLUser{
+			ObjectMeta: discoverMeta("dos-user", "default", nil),
+			Spec:       sqlv1beta1.SQLUserSpec{InstanceRef: v1alpha1.ResourceRef{Name: "dos"}},
+		},
+	)
+	app := newTestApp("default", nil, client, nil)
+
+	m, err := app.DiscoverManifest(context.TODO(), "team=payments")
+	require.NoError(t, err)
+	assert.Equal(t, []SqlInstance{{Name: "dos"}, {Name: "uno"}}, m.Instances)
+	assert.Equal(t, []SqlDatabase{{Name: "dos-db", InstanceName: "dos"}, {Name: "uno-db", InstanceName: "uno"}}, m.Databases)
+	assert.Equal(t, []SqlUser{
+		{Name: "dos-user", InstanceName: "dos"},
+		{Name: "uno-reader", InstanceName: "uno"},
+		{Name: "uno-user", InstanceName: "uno"},
+	}, m.Users)
+
+	m, err = app.DiscoverManifest(context.TODO(), "")
+	require.NoError(t, err)
+	assert.Len(t, m.Instances, 2)
+	assert.Len(t, m.Databases, 2)
+	assert.Len(t, m.Users, 3)
+}
+
+func TestDiscoverManifestEmptyNamespace(t *testing.T) {
+	client := cnrmfake.NewSimpleClientset(&sqlv1beta1.SQLInstance{ObjectMeta: discoverMeta("uno", "default", nil)})
+	app := newTestApp("empty", nil, client, nil)
+
+	_, err := app.DiscoverManifest(context.TODO(), "")
+	assert.EqualError(t, err, `no SQL resources found in namespace "empty" matching selector ""`)
+}
+
+func TestDiscoverManifestInvalidSelector(t *testing.T) {
+	app := newTestApp("default", nil, cnrmfake.NewSimpleClientset(), nil)
+
+	_, err := app.DiscoverManifest(context.TODO(), "team in (")
+	assert.ErrorContains(t, err, "invalid label selector")
+}
@@ -1,55 +1,99 @@
 package k8s
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
 
-	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
-	sqlv1beta1 "github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/sql/v1beta1"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
 func (s *SqlInstanceGroup) watchEvents(
+	ctx context.Context,
 	watcher watch.Interface,
 	eventsChan chan<- SqlInstanceGroupEvent,
 	baseEvent SqlInstanceGroupEvent,
 ) error {
+	tracker := &failureTracker{policy: s.Policy}
+	var last Readiness
+	logger := s.app.resourceLogger(baseEvent)
+	started := time.Now()
+
+	// graceTimer fires when a resource that is failing runs out of grace
+	graceTimer := time.NewTimer(0)
+	if !graceTimer.Stop() {
+		<-graceTimer.C
+	}
+	defer graceTimer.Stop()
+
 	for {
 		select {
-		case e := <-watcher.ResultChan():
+		case e, ok := <-watcher.ResultChan():
+			if !ok {
+				return errors.New("resource watch closed")
+			}
+			if e.Type == watch.Deleted {
+				return &terminalError{
+					Reason:  "Deleted",
+					Message: fmt.Sprintf("%s %s was deleted while waiting for it", baseEvent.Type, baseEvent.Name),
+				}
+			}
 			event, healthy := s.processEvent(baseEvent, e)
 			eventsChan <- event
 			if healthy {
-				fmt.Printf("%s %s complete\n", event.Type, event.Name)
 				return nil
 			}
-		case <-s.ctx.Done():
-			return errors.New("resource watch timed out on context")
+			if event.Readiness == "" {
+				continue
+			}
+
+			last = Readiness{State: event.Readiness, Condition: event.Condition}
+			attempts := tracker.attempts
+			remaining, err := tracker.observe(last, time.Now())
+			if err != nil {
+				return err
+			}
+			if tracker.attempts > attempts {
+				logger.Warn("resource failing, waiting out the grace period",
+					logKeyReason, event.Condition.Reason,
+					logKeyAttempt, tracker.attempts,
+					logKeyElapsed, time.Since(started).Round(time.Millisecond),
+					"grace", remaining)
+			}
+			graceTimer.Stop()
+			if remaining > 0 {
+				graceTimer.Reset(remaining)
+			}
+		case <-graceTimer.C:
+			if _, err := tracker.observe(last, time.Now()); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			if errors.Is(context.Cause(ctx), errGroupFailed) {
+				return errGroupFailed
+			}
+			return timeoutError(ctx)
 		}
 	}
 }
 
 func (s *SqlInstanceGroup) processEvent(baseEvent SqlInstanceGroupEvent, event watch.Event) (SqlInstanceGroupEvent, bool) {
-	var sc *v1alpha1.Condition
+	baseEvent.State = StatePending
+	if event.Type != watch.Added && event.Type != watch.Modified {
+		return baseEvent, false
+	}
 
-	switch baseEvent.Type {
-	case SqlResourceInstance:
-		instance, ok := event.Object.(*sqlv1beta1.SQLInstance)
-		if ok && len(instance.Status.Conditions) > 0 {
-			sc = &instance.Status.Conditions[0]
-		}
-	case SqlResourceDatabase:
-		database, ok := event.Object.(*sqlv1beta1.SQLDatabase)
-		if ok && len(database.Status.Conditions) > 0 {
-			sc = &database.Status.Conditions[0]
-		}
-	case SqlResourceUser:
-		user, ok := event.Object.(*sqlv1beta1.SQLUser)
-		if ok && len(user.Status.Conditions) > 0 {
-			sc = &user.Status.Conditions[0]
-		}
+	readiness, err := ObjectReadiness(event.Object)
+	if err != nil {
+		baseEvent.Error = &AppError{Name: "processEvent", Message: fmt.Sprint(err)}
 	}
-	baseEvent.Condition = sc
+	baseEvent.Condition = readiness.Condition
+	baseEvent.Readiness = readiness.State
 
-	return baseEvent, baseEvent.Condition != nil && baseEvent.Condition.Reason == "UpToDate"
-}
\ No newline at end of file
+	healthy := readiness.State == ReadinessReady
+	if healthy {
+		baseEvent.State = StateReady
+	}
+	return baseEvent, healthy
+}
@@ -0,0 +1,80 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// defaultFailureGracePeriod is how long a terminal reason has to persist
+// before a resource is failed. Config Connector resources often report
+// UpdateFailed briefly while their dependencies are created, so failing on
+// the first event would be too eager.
+const defaultFailureGracePeriod = time.Minute
+
+// FailurePolicy controls how a group reacts to resources in a terminal state
+// such as UpdateFailed or DependencyInvalid.
+type FailurePolicy struct {
+	// GracePeriod is how long a terminal reason must persist before the
+	// resource's wait ends with an error.
+	GracePeriod time.Duration
+	// FailFast stops waiting on the rest of the group as soon as one of its
+	// resources fails. Otherwise the other resources keep going.
+	FailFast bool
+}
+
+func DefaultFailurePolicy() FailurePolicy {
+	return FailurePolicy{GracePeriod: defaultFailureGracePeriod}
+}
+
+// errGroupFailed is the cancellation cause for the rest of a fail-fast group.
+var errGroupFailed = errors.New("another resource in the group failed")
+
+// terminalError ends a resource's wait because it has been in a terminal
+// state for longer than the grace period, or was deleted.
+type terminalError struct {
+	Reason  string
+	Message string
+	For     time.Duration
+}
+
+func (e *terminalError) Error() string {
+	if e.For == 0 {
+		return fmt.Sprintf("%s: %s", e.Reason, e.Message)
+	}
+	return fmt.Sprintf("%s for %s: %s", e.Reason, e.For.Round(time.Second), e.Message)
+}
+
+// failureTracker remembers when a resource entered a terminal state, and
+// how many times it has.
+type failureTracker struct {
+	policy   FailurePolicy
+	since    time.Time
+	attempts int
+}
+
+// observe records the latest readiness. It returns an error once a terminal
+// state has outlasted the grace period, and otherwise how long is left
+// before it would, or zero when the resource isn't failing.
+func (t *failureTracker) observe(r Readiness, now time.Time) (time.Duration, error) {
+	if r.State != ReadinessFailed {
+		t.since = time.Time{}
+		return 0, nil
+	}
+	if t.since.IsZero() {
+		t.since = now
+		t.attempts++
+	}
+
+	failingFor := now.Sub(t.since)
+	if failingFor < t.policy.GracePeriod {
+		return t.policy.GracePeriod - failingFor, nil
+	}
+
+	terr := &terminalError{For: failingFor}
+	if r.Condition != nil {
+		terr.Reason = r.Condition.Reason
+		terr.Message = r.Condition.Message
+	}
+	return 0, terr
+}
@@ -0,0 +1,53 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureTracker(t *testing.T) {
+	tracker := &failureTracker{policy: FailurePolicy{GracePeriod: 30 * time.Second}}
+	failed := Readiness{
+		State:     ReadinessFailed,
+		Condition: &v1alpha1.Condition{Reason: ReasonUpdateFailed, Message: "password does not meet policy"},
+	}
+	now := time.Now()
+
+	remaining, err := tracker.observe(failed, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, remaining)
+
+	// recovering resets the grace period
+	_, err = tracker.observe(Readiness{State: ReadinessProgressing}, now.Add(20*time.Second))
+	assert.NoError(t, err)
+	remaining, err = tracker.observe(failed, now.Add(25*time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, remaining)
+	assert.Equal(t, 2, tracker.attempts)
+
+	_, err = tracker.observe(failed, now.Add(55*time.Second))
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "UpdateFailed for 30s: password does not meet policy"), err.Error())
+}
+
+func TestGroupFailurePolicyFromManifest(t *testing.T) {
+	m, err := LoadManifest(strings.NewReader(`
+instances:
+- name: uno
+  failFast: true
+  failureGracePeriod: 15s
+- name: dos
+`))
+	assert.NoError(t, err)
+
+	sig := NewSqlInstanceGroupList(context.TODO(), NewApp(""))
+	assert.NoError(t, sig.InitGroupsFromManifest(m))
+
+	assert.Equal(t, FailurePolicy{GracePeriod: 15 * time.Second, FailFast: true}, sig.GetGroup("uno").Policy)
+	assert.Equal(t, DefaultFailurePolicy(), sig.GetGroup("dos").Policy)
+}
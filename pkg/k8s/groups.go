@@ -5,48 +5,127 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type SqlInstance struct {
 	Name string `yaml:"name" json:"name"`
+	// Namespace defaults to the namespace of the cluster's kubeconfig context.
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	// Cluster is the kubeconfig context of the cluster the instance lives in,
+	// or empty for the current one.
+	Cluster string `yaml:"cluster,omitempty" json:"cluster,omitempty"`
+	// FailFast stops waiting on the rest of the group as soon as one of its
+	// resources fails.
+	FailFast bool `yaml:"failFast,omitempty" json:"failFast,omitempty"`
+	// FailureGracePeriod is how long a resource may stay in a terminal state
+	// such as UpdateFailed before it is failed.
+	FailureGracePeriod *metav1.Duration `yaml:"failureGracePeriod,omitempty" json:"failureGracePeriod,omitempty"`
+	// Timeout is how long the whole group may take: the instance, then its
+	// databases, users and resources.
+	Timeout *metav1.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// Tier, Region and DatabaseVersion are the spec ApplyCloudSQL gives the
+	// SQLInstance, which needs at least a tier.
+	Tier            string `yaml:"tier,omitempty" json:"tier,omitempty"`
+	Region          string `yaml:"region,omitempty" json:"region,omitempty"`
+	DatabaseVersion string `yaml:"databaseVersion,omitempty" json:"databaseVersion,omitempty"`
 }
 
+// SqlDatabase and SqlUser default to the namespace of their instance. The
+// instance is found by name in the same cluster, and in Namespace when it is
+// set. Charset, Collation and PasswordSecretRef are only used by
+// ApplyCloudSQL.
 type SqlDatabase struct {
 	Name         string `yaml:"name" json:"name"`
 	InstanceName string `yaml:"instanceName" json:"instanceName"`
+	Namespace    string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Cluster      string `yaml:"cluster,omitempty" json:"cluster,omitempty"`
+	Charset      string `yaml:"charset,omitempty" json:"charset,omitempty"`
+	Collation    string `yaml:"collation,omitempty" json:"collation,omitempty"`
 }
 
 type SqlUser struct {
 	Name         string `yaml:"name" json:"name"`
 	InstanceName string `yaml:"instanceName" json:"instanceName"`
+	Namespace    string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Cluster      string `yaml:"cluster,omitempty" json:"cluster,omitempty"`
+	// PasswordSecretRef is the key of the Secret holding the password.
+	PasswordSecretRef *v1alpha1.SecretKeyRef `yaml:"passwordSecretRef,omitempty" json:"passwordSecretRef,omitempty"`
+}
+
+// KccResource is any other Config Connector resource to wait on. Kind is
+// looked up with LookupKind unless APIVersion is given. Resources with an
+// InstanceName are waited on once that instance is ready, like databases and
+// users; the rest are waited on straight away.
+type KccResource struct {
+	Kind         DependencyType `yaml:"kind" json:"kind"`
+	APIVersion   string         `yaml:"apiVersion,omitempty" json:"apiVersion,omitempty"`
+	Name         string         `yaml:"name" json:"name"`
+	InstanceName string         `yaml:"instanceName,omitempty" json:"instanceName,omitempty"`
+	Namespace    string         `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Cluster      string         `yaml:"cluster,omitempty" json:"cluster,omitempty"`
 }
 
 type SqlInstanceGroup struct {
 	Name      string
+	Namespace string
+	Cluster   string
 	Instance  *SqlInstance
 	Databases []*SqlDatabase
 	Users     []*SqlUser
-	wg        sync.WaitGroup
-	ctx       context.Context
-	app       *Application
+	Resources []*KccResource
+	// Dependents are the workloads that depend on the instance.
+	Dependents []*Workload
+	Policy     FailurePolicy
+	// Timeout is how long the whole group may take, or zero for as long as
+	// the overall deadline allows.
+	Timeout time.Duration
+	wg      sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	app     *Application
+	// timeouts are the list's, for the budget of each kind.
+	timeouts Timeouts
+	// standalone groups hold resources that don't belong to an instance, so
+	// there is no instance to wait on first.
+	standalone bool
+	// done is closed once Watch returns, and failed is set by then when any
+	// resource of the group wasn't ready.
+	done   chan struct{}
+	failed atomic.Bool
 }
 
 type SqlInstanceGroupList struct {
-	Groups []*SqlInstanceGroup
-	ctx    context.Context
-	events chan SqlInstanceGroupEvent
-	wg     *sync.WaitGroup
-	app    *Application
+	Groups     []*SqlInstanceGroup
+	Standalone *SqlInstanceGroup
+	Workloads  []*Workload
+	// Timeouts are the overall deadline and the budget of each kind.
+	Timeouts Timeouts
+	ctx      context.Context
+	events   chan SqlInstanceGroupEvent
+	wg       *sync.WaitGroup
+	app      *Application
 }
 
 type SqlInstanceGroupEvent struct {
 	Group     *SqlInstanceGroup
 	Type      DependencyType
 	Name      string
+	Namespace string
+	Cluster   string
 	Condition *v1alpha1.Condition
+	Readiness ReadinessState
+	State     ResourceState
 	Error     *AppError
+	Time      time.Time
+	// Events are the Kubernetes Events about the resource so far, and for a
+	// workload those about its ReplicaSets and pods.
+	Events []ObjectEvent
 }
 
 type DependencyType string
@@ -66,7 +145,7 @@ var (
 		{Name: "td-dos-db", InstanceName: "test-deployments-mysql-dos"},
 		{Name: "td-tres-db", InstanceName: "test-deployments-mysql-tres"},
 	}
-	sqlUsers     = [5]SqlUser{
+	sqlUsers = [5]SqlUser{
 		{Name: "td-uno-user", InstanceName: "test-deployments-mysql-uno"},
 		{Name: "td-dos-user", InstanceName: "test-deployments-mysql-dos"},
 		{Name: "td-tres-user-1", InstanceName: "test-deployments-mysql-tres"},
@@ -80,13 +159,60 @@ func (t *DependencyType) String() string {
 }
 
 func NewSqlInstanceGroupList(ctx context.Context, app *Application) *SqlInstanceGroupList {
-	return &SqlInstanceGroupList{
+	s := &SqlInstanceGroupList{
 		Groups: make([]*SqlInstanceGroup, 0),
 		wg:     &sync.WaitGroup{},
 		ctx:    ctx,
 		events: make(chan SqlInstanceGroupEvent),
 		app:    app,
 	}
+	if app != nil {
+		s.Timeouts = app.timeouts
+	}
+	s.Standalone = s.NewGroup("")
+	s.Standalone.standalone = true
+	return s
+}
+
+// GroupVersionKind resolves the resource's kind, from its APIVersion when set
+// and from the kind registry otherwise.
+func (r *KccResource) GroupVersionKind() (schema.GroupVersionKind, error) {
+	if r.APIVersion != "" {
+		gv, err := schema.ParseGroupVersion(r.APIVersion)
+		if err != nil {
+			return schema.GroupVersionKind{}, err
+		}
+		return gv.WithKind(string(r.Kind)), nil
+	}
+	gvk, ok := LookupKind(r.Kind)
+	if !ok {
+		return schema.GroupVersionKind{}, fmt.Errorf("unknown kind %q, set apiVersion or register it", r.Kind)
+	}
+	return gvk, nil
+}
+
+// namespaceFor returns the namespace a resource of the group lives in: its
+// own when set, then the group's, then the default of the group's cluster.
+func (g *SqlInstanceGroup) namespaceFor(namespace string) string {
+	if namespace != "" {
+		return namespace
+	}
+	if g.Namespace != "" {
+		return g.Namespace
+	}
+	if app, err := g.app.Cluster(g.Cluster); err == nil {
+		return app.namespace
+	}
+	return g.app.namespace
+}
+
+// clusterFor returns the cluster a resource of the group lives in. Only
+// standalone resources can be in a cluster of their own.
+func (g *SqlInstanceGroup) clusterFor(cluster string) string {
+	if g.standalone {
+		return cluster
+	}
+	return g.Cluster
 }
 
 func (s *SqlInstanceGroupList) NewGroup(name string) *SqlInstanceGroup {
@@ -94,8 +220,10 @@ func (s *SqlInstanceGroupList) NewGroup(name string) *SqlInstanceGroup {
 		Name:      name,
 		Databases: make([]*SqlDatabase, 0),
 		Users:     make([]*SqlUser, 0),
+		Policy:    DefaultFailurePolicy(),
 		ctx:       s.ctx,
 		app:       s.app,
+		done:      make(chan struct{}),
 	}
 }
 
@@ -126,16 +254,42 @@ func (s *SqlInstanceGroupList) HasGroup(name string) bool {
 	return false
 }
 
+// instanceGroup finds the group of the named instance in cluster. When both
+// the instance and the resource looking for it have a namespace, they must
+// match, the same as SqlManifest.Validate checks.
+func (s *SqlInstanceGroupList) instanceGroup(name, cluster, namespace string) *SqlInstanceGroup {
+	for _, g := range s.Groups {
+		if g.Name == name && g.Cluster == cluster &&
+			(namespace == "" || g.Namespace == "" || g.Namespace == namespace) {
+			return g
+		}
+	}
+	return nil
+}
+
 func (s *SqlInstanceGroupList) AddInstance(i SqlInstance) {
-	if s.HasGroup(i.Name) {
-		return
+	for _, g := range s.Groups {
+		if g.Name == i.Name && g.Cluster == i.Cluster && g.Namespace == i.Namespace {
+			return
+		}
+	}
+	group := s.NewGroup(i.Name)
+	group.Namespace = i.Namespace
+	group.Cluster = i.Cluster
+	group.Instance = &i
+	group.Policy.FailFast = i.FailFast
+	if i.FailureGracePeriod != nil {
+		group.Policy.GracePeriod = i.FailureGracePeriod.Duration
 	}
-	s.AddGroup(s.NewGroup(i.Name))
+	if i.Timeout != nil {
+		group.Timeout = i.Timeout.Duration
+	}
+	s.Groups = append(s.Groups, group)
 }
 
 func (s *SqlInstanceGroupList) AddDatabase(d SqlDatabase) {
 	var group *SqlInstanceGroup
-	if group = s.GetGroup(d.InstanceName); group == nil {
+	if group = s.instanceGroup(d.InstanceName, d.Cluster, d.Namespace); group == nil {
 		group = s.NewGroup(d.InstanceName)
 	}
 	group.AddDatabase(d)
@@ -143,12 +297,42 @@ func (s *SqlInstanceGroupList) AddDatabase(d SqlDatabase) {
 
 func (s *SqlInstanceGroupList) AddUser(u SqlUser) {
 	var group *SqlInstanceGroup
-	if group = s.GetGroup(u.InstanceName); group == nil {
+	if group = s.instanceGroup(u.InstanceName, u.Cluster, u.Namespace); group == nil {
 		group = s.NewGroup(u.InstanceName)
 	}
 	group.AddUser(u)
 }
 
+func (s *SqlInstanceGroupList) AddResource(r KccResource) {
+	if r.InstanceName == "" {
+		s.Standalone.AddResource(r)
+		return
+	}
+	var group *SqlInstanceGroup
+	if group = s.instanceGroup(r.InstanceName, r.Cluster, r.Namespace); group == nil {
+		group = s.NewGroup(r.InstanceName)
+		group.Cluster = r.Cluster
+		s.Groups = append(s.Groups, group)
+	}
+	group.AddResource(r)
+}
+
+func (g *SqlInstanceGroup) AddResource(r KccResource) {
+	if !g.HasResource(r) {
+		g.Resources = append(g.Resources, &r)
+	}
+}
+
+func (g *SqlInstanceGroup) HasResource(r KccResource) bool {
+	for _, resource := range g.Resources {
+		if r.Kind == resource.Kind && r.Name == resource.Name &&
+			r.Namespace == resource.Namespace && r.Cluster == resource.Cluster {
+			return true
+		}
+	}
+	return false
+}
+
 func (g *SqlInstanceGroup) AddDatabase(d SqlDatabase) {
 	if !g.HasDatabase(d) {
 		g.Databases = append(g.Databases, &d)
@@ -157,7 +341,7 @@ func (g *SqlInstanceGroup) AddDatabase(d SqlDatabase) {
 
 func (g *SqlInstanceGroup) HasDatabase(d SqlDatabase) bool {
 	for _, database := range g.Databases {
-		if d.Name == database.Name {
+		if d.Name == database.Name && d.Namespace == database.Namespace {
 			return true
 		}
 	}
@@ -172,7 +356,7 @@ func (g *SqlInstanceGroup) AddUser(u SqlUser) {
 
 func (g *SqlInstanceGroup) HasUser(u SqlUser) bool {
 	for _, user := range g.Users {
-		if u.Name == user.Name {
+		if u.Name == user.Name && u.Namespace == user.Namespace {
 			return true
 		}
 	}
@@ -197,10 +381,38 @@ func (s *SqlInstanceGroupList) String() string {
 			str.WriteString(user.Name)
 			str.WriteRune('\n')
 		}
+		writeResources(&str, "  ", group.Resources)
+		if len(group.Dependents) > 0 {
+			str.WriteString("  Dependents:\n")
+			for _, w := range group.Dependents {
+				str.WriteString("  - ")
+				str.WriteString(w.ref())
+				str.WriteRune('\n')
+			}
+		}
+	}
+	if len(s.Standalone.Resources) > 0 {
+		writeResources(&str, "", s.Standalone.Resources)
 	}
 	return str.String()
 }
 
+func writeResources(str *strings.Builder, indent string, resources []*KccResource) {
+	if len(resources) == 0 {
+		return
+	}
+	str.WriteString(indent)
+	str.WriteString("Resources:\n")
+	for _, r := range resources {
+		str.WriteString(indent)
+		str.WriteString("- ")
+		str.WriteString(string(r.Kind))
+		str.WriteRune('/')
+		str.WriteString(r.Name)
+		str.WriteRune('\n')
+	}
+}
+
 func (s *SqlInstanceGroupList) InitGroups() {
 	for _, instance := range sqlInstances {
 		s.AddInstance(instance)
@@ -211,4 +423,4 @@ func (s *SqlInstanceGroupList) InitGroups() {
 	for _, user := range sqlUsers {
 		s.AddUser(user)
 	}
-}
\ No newline at end of file
+}
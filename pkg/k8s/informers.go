@@ -0,0 +1,396 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	nameIndex        = "name"
+	instanceRefIndex = "instanceRef"
+
+	syncPollInterval = 100 * time.Millisecond
+)
+
+// informerCache shares one informer per resource kind and namespace between
+// every waiter, so the API server sees a single list and watch per kind no
+// matter how many groups are being waited on.
+type informerCache struct {
+	mu        sync.Mutex
+	client    dynamic.Interface
+	metrics   *Metrics
+	informers map[informerKey]*sharedInformer
+	// ctx ends every informer; stopAll replaces it for the next ones.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type informerKey struct {
+	gvr       schema.GroupVersionResource
+	namespace string
+}
+
+type sharedInformer struct {
+	gvr      schema.GroupVersionResource
+	informer cache.SharedIndexInformer
+	// cancel stops the informer and its requests.
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	subscribers map[string]map[*subscription]bool
+
+	// syncFailed is closed when listing fails before the cache has synced
+	// with an error that won't go away on a retry, syncErr then holds it.
+	syncFailed chan struct{}
+	failOnce   sync.Once
+	errMu      sync.Mutex
+	syncErr    error
+}
+
+func newInformerCache(client dynamic.Interface, metrics *Metrics) *informerCache {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &informerCache{
+		client:    client,
+		metrics:   metrics,
+		informers: make(map[informerKey]*sharedInformer),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// get returns the informer for gvr in namespace, starting it on first use
+// and waiting for its cache to sync. An informer that can't list, because
+// its CRD is missing or access is denied, fails with the list error instead
+// of retrying until ctx is done, and is dropped so that the next get starts
+// afresh. Other list errors are retried.
+func (c *informerCache) get(ctx context.Context, gvr schema.GroupVersionResource, namespace string) (*sharedInformer, error) {
+	c.mu.Lock()
+	key := informerKey{gvr: gvr, namespace: namespace}
+	si, ok := c.informers[key]
+	if !ok {
+		informerCtx, cancel := context.WithCancel(c.ctx)
+		si = newSharedInformer(informerCtx, c.client, gvr, namespace, c.metrics)
+		si.cancel = cancel
+		c.informers[key] = si
+		go si.informer.Run(informerCtx.Done())
+	}
+	c.mu.Unlock()
+
+	ticker := time.NewTicker(syncPollInterval)
+	defer ticker.Stop()
+	for !si.informer.HasSynced() {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%s informer did not sync: %w", gvr.Resource, context.Cause(ctx))
+		case <-si.syncFailed:
+			c.evict(key, si)
+			return nil, fmt.Errorf("list %s: %w", gvr.Resource, si.listError())
+		case <-ticker.C:
+		}
+	}
+	return si, nil
+}
+
+// evict stops si and drops it, unless it was already replaced.
+func (c *informerCache) evict(key informerKey, si *sharedInformer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.informers[key] == si {
+		delete(c.informers, key)
+	}
+	si.cancel()
+}
+
+// stopAll stops every informer. They are started again on the next get.
+func (c *informerCache) stopAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancel()
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.informers = make(map[informerKey]*sharedInformer)
+}
+
+func newSharedInformer(ctx context.Context, client dynamic.Interface, gvr schema.GroupVersionResource, namespace string, metrics *Metrics) *sharedInformer {
+	indexers := cache.Indexers{
+		nameIndex:        nameIndexFunc,
+		instanceRefIndex: instanceRefIndexFunc,
+	}
+	si := &sharedInformer{
+		gvr:         gvr,
+		informer:    cache.NewSharedIndexInformer(instrumentedListWatch(ctx, client, gvr, namespace, metrics), &unstructured.Unstructured{}, 0, indexers),
+		subscribers: make(map[string]map[*subscription]bool),
+		syncFailed:  make(chan struct{}),
+	}
+	_ = si.informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		cache.DefaultWatchErrorHandler(r, err)
+		if !si.informer.HasSynced() && permanentListError(err) {
+			si.errMu.Lock()
+			si.syncErr = err
+			si.errMu.Unlock()
+			si.failOnce.Do(func() { close(si.syncFailed) })
+		}
+	})
+	si.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			si.dispatch(watch.Added, obj)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			si.dispatch(watch.Modified, obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			si.dispatch(watch.Deleted, obj)
+		},
+	})
+	return si
+}
+
+// permanentListError reports whether a list error won't go away on a retry:
+// the resource isn't served, such as when its CRD is missing, or access to it
+// is denied. Timeouts, server errors and dropped connections are retried.
+func permanentListError(err error) bool {
+	return apierrors.IsNotFound(err) || apierrors.IsForbidden(err) || meta.IsNoMatchError(err)
+}
+
+// instrumentedListWatch lists and watches like a dynamic informer does,
+// counting failed requests, and a watch as a restart when the one before it
+// failed, its resourceVersion expired or it was dropped before its timeout.
+// Watches the server ends after their timeout are started again routinely
+// and aren't counted.
+func instrumentedListWatch(ctx context.Context, client dynamic.Interface, gvr schema.GroupVersionResource, namespace string, metrics *Metrics) *cache.ListWatch {
+	resource := client.Resource(gvr).Namespace(namespace)
+	var (
+		mu     sync.Mutex
+		failed bool
+		// until is when the last watch was due to time out, zero before the
+		// first one.
+		until time.Time
+	)
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			list, err := resource.List(ctx, options)
+			if err != nil {
+				metrics.apiError(gvr, "list")
+			}
+			return list, err
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			now := time.Now()
+			mu.Lock()
+			if failed || now.Before(until) {
+				metrics.watchRestarted(gvr)
+			}
+			failed = false
+			until = now
+			if options.TimeoutSeconds != nil {
+				until = now.Add(time.Duration(*options.TimeoutSeconds) * time.Second)
+			}
+			mu.Unlock()
+
+			w, err := resource.Watch(ctx, options)
+			if err != nil {
+				metrics.apiError(gvr, "watch")
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+				return w, err
+			}
+			return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+				if e.Type == watch.Error {
+					mu.Lock()
+					failed = true
+					mu.Unlock()
+				}
+				return e, true
+			}), nil
+		},
+	}
+}
+
+func (si *sharedInformer) listError() error {
+	si.errMu.Lock()
+	defer si.errMu.Unlock()
+	return si.syncErr
+}
+
+func nameIndexFunc(obj interface{}) ([]string, error) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	return []string{m.GetName()}, nil
+}
+
+// instanceRefIndexFunc indexes SQL databases, users and anything else with a
+// spec.instanceRef by the name of the instance they belong to.
+func instanceRefIndexFunc(obj interface{}) ([]string, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, nil
+	}
+	name, found, err := unstructured.NestedString(u.Object, "spec", "instanceRef", "name")
+	if err != nil || !found || name == "" {
+		return nil, nil
+	}
+	return []string{name}, nil
+}
+
+// lookup returns the cached object with the given name.
+func (si *sharedInformer) lookup(name string) (*unstructured.Unstructured, error) {
+	objs, err := si.informer.GetIndexer().ByIndex(nameIndex, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(objs) == 0 {
+		return nil, apierrors.NewNotFound(si.gvr.GroupResource(), name)
+	}
+	return objs[0].(*unstructured.Unstructured), nil
+}
+
+// byInstanceRef returns the names of the cached objects that reference the
+// given instance.
+func (si *sharedInformer) byInstanceRef(instance string) ([]string, error) {
+	objs, err := si.informer.GetIndexer().ByIndex(instanceRefIndex, instance)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		names = append(names, obj.(*unstructured.Unstructured).GetName())
+	}
+	return names, nil
+}
+
+// subscribe returns a watch of a single object. The current state is sent
+// as an Added event straight away if the object exists.
+func (si *sharedInformer) subscribe(name string) watch.Interface {
+	sub := &subscription{
+		name:   name,
+		parent: si,
+		events: make(chan watch.Event),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+
+	si.mu.Lock()
+	if si.subscribers[name] == nil {
+		si.subscribers[name] = make(map[*subscription]bool)
+	}
+	si.subscribers[name][sub] = true
+	si.mu.Unlock()
+
+	if obj, err := si.lookup(name); err == nil {
+		sub.send(watch.Event{Type: watch.Added, Object: obj.DeepCopy()})
+	}
+	go sub.run()
+	return sub
+}
+
+func (si *sharedInformer) dispatch(eventType watch.EventType, obj interface{}) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	si.mu.Lock()
+	subs := make([]*subscription, 0, len(si.subscribers[u.GetName()]))
+	for sub := range si.subscribers[u.GetName()] {
+		subs = append(subs, sub)
+	}
+	si.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.send(watch.Event{Type: eventType, Object: u.DeepCopy()})
+	}
+}
+
+// subscription implements watch.Interface for one object of a shared
+// informer. Events are queued so that a slow waiter never holds up the
+// informer or the other waiters.
+type subscription struct {
+	name   string
+	parent *sharedInformer
+	events chan watch.Event
+	notify chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	mu      sync.Mutex
+	pending []watch.Event
+}
+
+var _ watch.Interface = &subscription{}
+
+func (s *subscription) send(e watch.Event) {
+	s.mu.Lock()
+	s.pending = append(s.pending, e)
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) run() {
+	defer close(s.events)
+	for {
+		s.mu.Lock()
+		batch := s.pending
+		s.pending = nil
+		s.mu.Unlock()
+
+		for _, e := range batch {
+			select {
+			case s.events <- e:
+			case <-s.done:
+				return
+			}
+		}
+
+		select {
+		case <-s.notify:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *subscription) ResultChan() <-chan watch.Event {
+	return s.events
+}
+
+func (s *subscription) Stop() {
+	s.once.Do(func() {
+		close(s.done)
+		s.parent.mu.Lock()
+		delete(s.parent.subscribers[s.name], s)
+		if len(s.parent.subscribers[s.name]) == 0 {
+			delete(s.parent.subscribers, s.name)
+		}
+		s.parent.mu.Unlock()
+	})
+}
+
+// informers returns the application's informer cache, creating it on first
+// use.
+func (app *Application) informers() *informerCache {
+	app.informersOnce.Do(func() {
+		app.informerCache = newInformerCache(app.dynClient, app.metrics)
+	})
+	return app.informerCache
+}
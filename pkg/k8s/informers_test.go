@@ -0,0 +1,162 @@
+package k8s
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func newTestDatabase(name, instance string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(mustLookupKind(SqlResourceDatabase))
+	u.SetNamespace("default")
+	u.SetName(name)
+	_ = unstructured.SetNestedField(u.Object, instance, "spec", "instanceRef", "name")
+	return u
+}
+
+func newTestInformerCache(objects ...runtime.Object) (*informerCache, schema.GroupVersionResource, *dynamicfake.FakeDynamicClient) {
+	gvr := kindResource(mustLookupKind(SqlResourceDatabase))
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "SQLDatabaseList"}, objects...)
+	return newInformerCache(client, nil), gvr, client
+}
+
+func TestInformerLookup(t *testing.T) {
+	c, gvr, _ := newTestInformerCache(newTestDatabase("db-1", "instance-1"), newTestDatabase("db-2", "instance-2"))
+	defer c.stopAll()
+
+	si, err := c.get(context.TODO(), gvr, "default")
+	require.NoError(t, err)
+
+	obj, err := si.lookup("db-1")
+	require.NoError(t, err)
+	assert.Equal(t, "db-1", obj.GetName())
+
+	_, err = si.lookup("db-3")
+	assert.True(t, apierrors.IsNotFound(err))
+
+	names, err := si.byInstanceRef("instance-2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db-2"}, names)
+}
+
+func TestInformerShared(t *testing.T) {
+	c, gvr, _ := newTestInformerCache()
+	defer c.stopAll()
+
+	a, err := c.get(context.TODO(), gvr, "default")
+	require.NoError(t, err)
+	b, err := c.get(context.TODO(), gvr, "default")
+	require.NoError(t, err)
+	assert.Same(t, a, b)
+}
+
+func TestInformerListError(t *testing.T) {
+	c, gvr, client := newTestInformerCache()
+	defer c.stopAll()
+	client.PrependReactor("list", "*", func(clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(gvr.GroupResource(), "", nil)
+	})
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	defer cancel()
+	_, err := c.get(ctx, gvr, "default")
+	require.Error(t, err)
+	assert.True(t, apierrors.IsForbidden(err))
+	assert.NoError(t, ctx.Err())
+}
+
+func TestInformerListErrorEvicted(t *testing.T) {
+	c, gvr, client := newTestInformerCache(newTestDatabase("db-1", "instance-1"))
+	defer c.stopAll()
+	var lists atomic.Int32
+	client.PrependReactor("list", "*", func(clienttesting.Action) (bool, runtime.Object, error) {
+		if lists.Add(1) == 1 {
+			return true, nil, apierrors.NewForbidden(gvr.GroupResource(), "", nil)
+		}
+		return false, nil, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	defer cancel()
+	_, err := c.get(ctx, gvr, "default")
+	assert.True(t, apierrors.IsForbidden(err), err)
+
+	// the failed informer isn't kept, so access granted since is seen
+	si, err := c.get(ctx, gvr, "default")
+	require.NoError(t, err)
+	_, err = si.lookup("db-1")
+	assert.NoError(t, err)
+}
+
+func TestInformerListRetried(t *testing.T) {
+	c, gvr, client := newTestInformerCache(newTestDatabase("db-1", "instance-1"))
+	defer c.stopAll()
+	var lists atomic.Int32
+	client.PrependReactor("list", "*", func(clienttesting.Action) (bool, runtime.Object, error) {
+		if lists.Add(1) == 1 {
+			return true, nil, apierrors.NewServiceUnavailable("try again")
+		}
+		return false, nil, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+	defer cancel()
+	si, err := c.get(ctx, gvr, "default")
+	require.NoError(t, err)
+	_, err = si.lookup("db-1")
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, lists.Load(), int32(2))
+}
+
+func TestInformerSubscribe(t *testing.T) {
+	c, gvr, client := newTestInformerCache(newTestDatabase("db-1", "instance-1"))
+	defer c.stopAll()
+
+	si, err := c.get(context.TODO(), gvr, "default")
+	require.NoError(t, err)
+
+	sub := si.subscribe("db-1")
+	defer sub.Stop()
+
+	next := func() watch.Event {
+		select {
+		case e := <-sub.ResultChan():
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+		return watch.Event{}
+	}
+
+	assert.Equal(t, watch.Added, next().Type)
+
+	// Other objects of the same kind aren't delivered.
+	_, err = client.Resource(gvr).Namespace("default").Create(context.TODO(), newTestDatabase("db-2", "instance-1"), metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	db := newTestDatabase("db-1", "instance-1")
+	db.SetLabels(map[string]string{"updated": "true"})
+	_, err = client.Resource(gvr).Namespace("default").Update(context.TODO(), db, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	e := next()
+	assert.Equal(t, watch.Modified, e.Type)
+	assert.Equal(t, "db-1", e.Object.(*unstructured.Unstructured).GetName())
+
+	require.NoError(t, client.Resource(gvr).Namespace("default").Delete(context.TODO(), "db-1", metav1.DeleteOptions{}))
+	assert.Equal(t, watch.Deleted, next().Type)
+}
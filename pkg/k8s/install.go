@@ -3,65 +3,89 @@ package k8s
 import (
 	"context"
 	"fmt"
-	"os"
+	"time"
 
 	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
 )
 
 func (app *Application) watchCloudSql(
 	events <-chan SqlInstanceGroupEvent,
+	report *WaitReport,
+	objectEvents *eventLog,
 	done <-chan interface{}) {
 	for {
 		select {
 		case e := <-events:
-			if e.Condition != nil {
-				fmt.Fprintln(os.Stdout,
-					fmtResourceStatus(e.Type.String(),
-						e.Name,
-						e.Condition))
+			if e.Time.IsZero() {
+				e.Time = time.Now()
+			}
+			e.Events = objectEvents.forObject(e.Cluster, e.Namespace, involvedKind(e.Type), e.Name)
+			app.logEvent(e, report.Started)
+			if err := app.getPrinter().PrintEvent(e); err != nil {
+				app.log().Error("print event", "error", err)
 			}
 			if e.Error != nil {
 				app.errors = append(app.errors, e.Error)
 			}
+			report.record(e)
 		case <-done:
-			fmt.Println("watchCloudSql done")
 			return
 		}
 	}
 }
 
-func (app *Application) WaitForCloudSQL() {
+// WaitForCloudSQL waits for every group in the manifest, or the built-in demo
+// groups when manifest is nil, within the manifest's timeouts and those set
+// with WithWaitTimeouts. The returned error is only set when nothing could be
+// waited on; check WaitReport.ExitCode for the outcome.
+func (app *Application) WaitForCloudSQL(ctx context.Context, manifest *SqlManifest) (*WaitReport, error) {
 	done := make(chan interface{})
 	defer close(done)
 
-	ctx, cancel := context.WithTimeout(context.Background(), cloudSQLWaitTimeout)
+	ctx, cancel := withBudget(ctx, "overall", app.waitTimeouts(manifest).overall())
 	defer cancel()
 
 	sqlInstanceGroups := NewSqlInstanceGroupList(ctx, app)
-	sqlInstanceGroups.InitGroups()
+	if manifest == nil {
+		sqlInstanceGroups.InitGroups()
+	} else if err := sqlInstanceGroups.InitGroupsFromManifest(manifest); err != nil {
+		return nil, err
+	}
 
 	// fmt.Fprint(os.Stdout, sqlInstanceGroups.String())
 
-	go app.watchCloudSql(sqlInstanceGroups.events, done)
+	report := newWaitReport(sqlInstanceGroups)
+	objectEvents := newEventLog()
+	report.trackEvents(objectEvents)
+	eventsCtx, stopEvents := context.WithCancel(ctx)
+	objectEvents.follow(eventsCtx, app)
+	go app.watchCloudSql(sqlInstanceGroups.events, report, objectEvents, done)
 
 	sqlInstanceGroups.Watch()
 	done <- nil // exit watchCloudSql
+	stopEvents()
+	for _, cluster := range app.allClusters() {
+		cluster.informers().stopAll()
+	}
 
-	for _, e := range app.errors {
-		fmt.Println(e.Name, e.Message)
+	report.finish(ctx)
+	report.addEvents(objectEvents)
+	if err := app.getPrinter().PrintReport(report); err != nil {
+		return report, err
 	}
+	return report, nil
 }
 
-func fmtResourceStatus(key, value string, con *v1alpha1.Condition) string {
-	return fmt.Sprintf("[%s%s%s] %s%s%s %s%s%s",
-		ColorBlue,
-		key,
-		ColorNc,
-		ColorWhite,
-		value,
-		ColorNc,
-		ColorRed,
-		con.Reason,
-		ColorNc,
+// fmtResourceStatus colors the reason by the state once the wait on the
+// resource is over, as a reason alone doesn't say whether it timed out.
+func fmtResourceStatus(style Style, key, value string, state ResourceState, con *v1alpha1.Condition) string {
+	severity := ReasonSeverity(con.Reason)
+	if state != "" && state != StatePending {
+		severity = StateSeverity(state)
+	}
+	return fmt.Sprintf("[%s] %s %s",
+		style.Kind(key),
+		style.Name(value),
+		style.Severity(severity, con.Reason),
 	)
-}
\ No newline at end of file
+}
@@ -1,12 +1,13 @@
 package k8s
 
 import (
-	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"time"
+	"sync"
 
 	cnrm "github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/client/clientset/versioned"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -14,38 +15,58 @@ import (
 
 type Application struct {
 	restConfig *rest.Config
-	kubeClient *kubernetes.Clientset
-	cnrmClient *cnrm.Clientset
+	kubeClient kubernetes.Interface
+	cnrmClient cnrm.Interface
+	dynClient  dynamic.Interface
 	namespace  string
 	errors     AppErrorsList
+	printer    Printer
+	logger     *slog.Logger
+	metrics    *Metrics
+	timeouts   Timeouts
+
+	informersOnce sync.Once
+	informerCache *informerCache
+
+	// opts are the options the application was created with, reused to
+	// create applications for other clusters.
+	opts       *appOptions
+	clustersMu sync.Mutex
+	clusters   map[string]*Application
 }
 
 type AppError struct {
-	Name     string
-	Message  string
+	Name    string `json:"name"`
+	Message string `json:"message"`
 }
 
-type AppErrorsList []*AppError
+func (e *AppError) Error() string {
+	return e.Name + ": " + e.Message
+}
 
-const (
-	cloudSQLWaitTimeout          =  20 * time.Minute
-	resourceCheckInterval        =  500 * time.Millisecond
-)
+type AppErrorsList []*AppError
 
 const (
-	ColorRed   = "\033[0;31m"
-	ColorWhite = "\033[0;37m"
-	ColorBlue  = "\033[1;34m"
-	ColorNc    = "\x1b[0m"
+	ColorRed    = "\033[0;31m"
+	ColorGreen  = "\033[0;32m"
+	ColorYellow = "\033[0;33m"
+	ColorWhite  = "\033[0;37m"
+	ColorBlue   = "\033[1;34m"
+	ColorNc     = "\x1b[0m"
 )
 
+// NewApp creates an application from $HOME/.kube/config, logging any error
+// and carrying on without clients.
+//
+// Deprecated: use New, which returns errors and supports $KUBECONFIG,
+// contexts and in-cluster config.
 func NewApp(namespace string) *Application {
 	var err error
 	var restConfig *rest.Config
 	configPath := filepath.Join(os.Getenv("HOME"), ".kube", "config")
 	restConfig, err = clientcmd.BuildConfigFromFlags("", configPath)
 	if err != nil {
-		fmt.Println(err)
+		slog.Error("load kubeconfig", "error", err)
 	}
 
 	app := &Application{
@@ -55,23 +76,49 @@ func NewApp(namespace string) *Application {
 
 	kubeClient, err := app.createClient()
 	if err != nil {
-		fmt.Println(err)
+		slog.Error("create kubernetes client", "error", err)
 	}
 	app.kubeClient = kubeClient
 
 	cnrmClient, err := app.createCNRM()
 	if err != nil {
-		fmt.Println(err)
+		slog.Error("create config connector client", "error", err)
 	}
 	app.cnrmClient = cnrmClient
 
+	dynClient, err := app.createDynamic()
+	if err != nil {
+		slog.Error("create dynamic client", "error", err)
+	}
+	app.dynClient = dynClient
+
 	return app
 }
 
+func (app *Application) Namespace() string {
+	return app.namespace
+}
+
+// SetPrinter replaces the default text output on stdout.
+func (app *Application) SetPrinter(p Printer) {
+	app.printer = p
+}
+
+func (app *Application) getPrinter() Printer {
+	if app.printer == nil {
+		app.printer = &textPrinter{w: os.Stdout, style: NewStyle(os.Stdout, Themes["default"], ColorAuto)}
+	}
+	return app.printer
+}
+
 func (app *Application) createClient() (*kubernetes.Clientset, error) {
 	return kubernetes.NewForConfig(app.restConfig)
 }
 
 func (app *Application) createCNRM() (*cnrm.Clientset, error) {
 	return cnrm.NewForConfig(app.restConfig)
+}
+
+func (app *Application) createDynamic() (dynamic.Interface, error) {
+	return dynamic.NewForConfig(app.restConfig)
 }
\ No newline at end of file
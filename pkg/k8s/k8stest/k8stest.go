@@ -0,0 +1,592 @@
+// Package k8stest provides a fake cluster for testing code built on the k8s
+// package. Config Connector resources live in the generated fake clientsets
+// and their Ready condition can be scripted to change over time, so the wait
+// logic can be exercised without a real cluster.
+package k8stest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	cnrmfake "github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/client/clientset/versioned/fake"
+	cnrmscheme "github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/client/clientset/versioned/scheme"
+	"github.com/chrisbradleydev/go-k8s/pkg/k8s"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	kubescheme "k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// Cluster is a fake cluster holding Config Connector resources. Resources
+// are created in Namespace; InNamespace returns a view of the same cluster
+// for another one. Every change is written to both the dynamic and the typed
+// Config Connector clientset so the two always agree.
+type Cluster struct {
+	Namespace string
+	*clients
+}
+
+type clients struct {
+	Kube    *kubefake.Clientset
+	CNRM    *cnrmfake.Clientset
+	Dynamic *dynamicfake.FakeDynamicClient
+
+	mu              sync.Mutex
+	resourceVersion int
+	events          int
+	watchers        []watch.Interface
+}
+
+func NewCluster(namespace string) *Cluster {
+	listKinds := make(map[schema.GroupVersionResource]string)
+	for _, gvk := range k8s.Kinds() {
+		listKinds[resource(gvk)] = gvk.Kind + "List"
+	}
+
+	c := &Cluster{
+		Namespace: namespace,
+		clients: &clients{
+			Kube:    kubefake.NewSimpleClientset(),
+			CNRM:    cnrmfake.NewSimpleClientset(),
+			Dynamic: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds),
+		},
+	}
+	for _, fake := range []*k8stesting.Fake{&c.Dynamic.Fake, &c.CNRM.Fake} {
+		tracker := c.Dynamic.Tracker()
+		if fake == &c.CNRM.Fake {
+			tracker = c.CNRM.Tracker()
+		}
+		fake.PrependReactor("list", "*", c.listReactor(tracker))
+		fake.PrependWatchReactor("*", c.watchReactor(tracker))
+	}
+	c.CNRM.PrependReactor("patch", "*", c.applyReactor())
+	c.Kube.PrependReactor("list", "*", c.listReactor(c.Kube.Tracker()))
+	c.Kube.PrependReactor("create", "*", c.versionReactor(c.Kube.Tracker()))
+	c.Kube.PrependReactor("update", "*", c.versionReactor(c.Kube.Tracker()))
+	c.Kube.PrependWatchReactor("*", c.watchReactor(c.Kube.Tracker()))
+	return c
+}
+
+// InNamespace returns the same cluster with resources created in namespace.
+func (c *Cluster) InNamespace(namespace string) *Cluster {
+	return &Cluster{Namespace: namespace, clients: c.clients}
+}
+
+// App returns an application that talks to the fake cluster, with Namespace
+// as its default namespace. Other fake clusters can be added with
+// k8s.WithCluster.
+func (c *Cluster) App(opts ...k8s.Option) *k8s.Application {
+	opts = append([]k8s.Option{
+		k8s.WithClients(c.Kube, c.CNRM, c.Dynamic),
+		k8s.WithNamespace(c.Namespace),
+	}, opts...)
+	app, err := k8s.New(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return app
+}
+
+// listReactor serves lists from the tracker like the default reactor, but
+// sets the list's resourceVersion to that of the last write, so watches can
+// start from it as they would against an API server.
+func (c *clients) listReactor(tracker k8stesting.ObjectTracker) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		handled, obj, err := k8stesting.ObjectReaction(tracker)(action)
+		if err != nil || obj == nil {
+			return handled, obj, err
+		}
+		list, err := meta.ListAccessor(obj)
+		if err != nil {
+			return true, nil, err
+		}
+		list.SetResourceVersion(strconv.Itoa(c.resourceVersion))
+		return true, obj, nil
+	}
+}
+
+// versionReactor creates and updates objects like the default reactor, but
+// gives each write a new resourceVersion as the API server does, so that
+// watches can resume from it.
+func (c *clients) versionReactor(tracker k8stesting.ObjectTracker) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		var obj runtime.Object
+		switch action := action.(type) {
+		case k8stesting.CreateAction:
+			obj = action.GetObject()
+		case k8stesting.UpdateAction:
+			obj = action.GetObject()
+		}
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			return false, nil, nil
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.resourceVersion++
+		m.SetResourceVersion(strconv.Itoa(c.resourceVersion))
+		return k8stesting.ObjectReaction(tracker)(action)
+	}
+}
+
+// watchReactor serves watches from the tracker like the default reactor, but
+// keeps hold of them so DropWatches can end them. The tracker can't resume
+// from a resourceVersion, so objects changed since the one asked for are sent
+// first; otherwise a change between a list and the watch would be lost.
+func (c *clients) watchReactor(tracker k8stesting.ObjectTracker) k8stesting.WatchReactionFunc {
+	return func(action k8stesting.Action) (bool, watch.Interface, error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		w, err := tracker.Watch(action.GetResource(), action.GetNamespace())
+		if err != nil {
+			return true, nil, err
+		}
+		if watchAction, ok := action.(k8stesting.WatchActionImpl); ok {
+			missed, err := c.changedSince(tracker, action, watchAction.GetWatchRestrictions().ResourceVersion)
+			if err != nil {
+				w.Stop()
+				return true, nil, err
+			}
+			if len(missed) > 0 {
+				w = replay(w, missed)
+			}
+		}
+		c.watchers = append(c.watchers, w)
+		return true, w, nil
+	}
+}
+
+// changedSince returns the objects of the watched resource written after
+// resourceVersion. c.mu must be held.
+func (c *clients) changedSince(tracker k8stesting.ObjectTracker, action k8stesting.Action, resourceVersion string) ([]runtime.Object, error) {
+	since, err := strconv.Atoi(resourceVersion)
+	if err != nil || since >= c.resourceVersion {
+		return nil, nil
+	}
+	gvk := kindOf(action.GetResource())
+	if gvk.Empty() {
+		return nil, nil
+	}
+
+	list, err := tracker.List(action.GetResource(), gvk, action.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	var changed []runtime.Object
+	for _, item := range items {
+		m, err := meta.Accessor(item)
+		if err != nil {
+			return nil, err
+		}
+		if rv, err := strconv.Atoi(m.GetResourceVersion()); err == nil && rv > since {
+			changed = append(changed, item)
+		}
+	}
+	return changed, nil
+}
+
+// replay sends a Modified event for each object before the events of w.
+func replay(w watch.Interface, objects []runtime.Object) watch.Interface {
+	result := make(chan watch.Event)
+	proxy := watch.NewProxyWatcher(result)
+	go func() {
+		defer close(result)
+		defer w.Stop()
+		for _, obj := range objects {
+			select {
+			case result <- watch.Event{Type: watch.Modified, Object: obj}:
+			case <-proxy.StopChan():
+				return
+			}
+		}
+		for {
+			select {
+			case e, ok := <-w.ResultChan():
+				if !ok {
+					return
+				}
+				select {
+				case result <- e:
+				case <-proxy.StopChan():
+					return
+				}
+			case <-proxy.StopChan():
+				return
+			}
+		}
+	}()
+	return proxy
+}
+
+// DropWatches ends every open watch, as an API server restart or a broken
+// connection would.
+func (c *clients) DropWatches() {
+	c.mu.Lock()
+	watchers := c.watchers
+	c.watchers = nil
+	c.mu.Unlock()
+
+	for _, w := range watchers {
+		w.Stop()
+	}
+}
+
+func (c *Cluster) AddInstance(name string) error {
+	return c.Create(k8s.SqlResourceInstance, name, nil)
+}
+
+func (c *Cluster) AddDatabase(name, instance string) error {
+	return c.Create(k8s.SqlResourceDatabase, name, instanceRef(instance))
+}
+
+func (c *Cluster) AddUser(name, instance string) error {
+	return c.Create(k8s.SqlResourceUser, name, instanceRef(instance))
+}
+
+// AddDeployment adds a Deployment whose rollout hasn't started yet.
+func (c *Cluster) AddDeployment(name string, replicas int32) error {
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: c.Namespace, Generation: 1},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 1},
+	}
+	_, err := c.Kube.AppsV1().Deployments(c.Namespace).Create(context.TODO(), d, metav1.CreateOptions{})
+	return err
+}
+
+// CompleteRollout marks every replica of a Deployment updated and available.
+func (c *Cluster) CompleteRollout(name string) error {
+	deployments := c.Kube.AppsV1().Deployments(c.Namespace)
+	d, err := deployments.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	replicas := *d.Spec.Replicas
+	d.Status = appsv1.DeploymentStatus{
+		ObservedGeneration: d.Generation,
+		Replicas:           replicas,
+		UpdatedReplicas:    replicas,
+		ReadyReplicas:      replicas,
+		AvailableReplicas:  replicas,
+	}
+	_, err = deployments.UpdateStatus(context.TODO(), d, metav1.UpdateOptions{})
+	return err
+}
+
+// RecordEvent adds a Kubernetes Event about the object of the given kind,
+// e.g. SQLInstance or Pod, or counts it again when the same one was already
+// recorded, as a controller's event recorder does.
+func (c *Cluster) RecordEvent(kind, name, eventType, reason, message string) error {
+	events := c.Kube.CoreV1().Events(c.Namespace)
+	list, err := events.List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	now := metav1.Now()
+	for i := range list.Items {
+		ev := &list.Items[i]
+		if ev.InvolvedObject.Kind == kind && ev.InvolvedObject.Name == name &&
+			ev.Type == eventType && ev.Reason == reason && ev.Message == message {
+			ev.Count++
+			ev.LastTimestamp = now
+			_, err = events.Update(context.TODO(), ev, metav1.UpdateOptions{})
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.events++
+	n := c.events
+	c.mu.Unlock()
+	_, err = events.Create(context.TODO(), &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: fmt.Sprintf("%s.%d", name, n), Namespace: c.Namespace},
+		InvolvedObject: corev1.ObjectReference{Kind: kind, Name: name, Namespace: c.Namespace},
+		Type:           eventType,
+		Reason:         reason,
+		Message:        message,
+		Count:          1,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+	}, metav1.CreateOptions{})
+	return err
+}
+
+func instanceRef(instance string) map[string]interface{} {
+	return map[string]interface{}{
+		"instanceRef": map[string]interface{}{"name": instance},
+	}
+}
+
+// Create adds a resource of a registered kind without any conditions, like
+// Config Connector before it has reconciled it.
+func (c *Cluster) Create(kind k8s.DependencyType, name string, spec map[string]interface{}) error {
+	gvk, ok := k8s.LookupKind(kind)
+	if !ok {
+		return fmt.Errorf("kind %s is not registered", kind)
+	}
+
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	u.SetNamespace(c.Namespace)
+	u.SetName(name)
+	u.SetGeneration(1)
+	if spec != nil {
+		u.Object["spec"] = spec
+	}
+	return c.write(u, true)
+}
+
+// SetReady replaces the Ready condition. It is True for UpToDate and False
+// for any other reason.
+func (c *Cluster) SetReady(kind k8s.DependencyType, name, reason, message string) error {
+	u, err := c.get(kind, name)
+	if err != nil {
+		return err
+	}
+
+	status := metav1.ConditionFalse
+	if reason == k8s.ReasonUpToDate {
+		status = metav1.ConditionTrue
+	}
+	conditions := []interface{}{
+		map[string]interface{}{
+			"type":               "Ready",
+			"status":             string(status),
+			"reason":             reason,
+			"message":            message,
+			"lastTransitionTime": time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+	if err := unstructured.SetNestedSlice(u.Object, conditions, "status", "conditions"); err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedField(u.Object, u.GetGeneration(), "status", "observedGeneration"); err != nil {
+		return err
+	}
+	return c.write(u, false)
+}
+
+// Delete removes a resource from both clientsets.
+func (c *Cluster) Delete(kind k8s.DependencyType, name string) error {
+	gvk, ok := k8s.LookupKind(kind)
+	if !ok {
+		return fmt.Errorf("kind %s is not registered", kind)
+	}
+	gvr := resource(gvk)
+
+	if err := c.Dynamic.Tracker().Delete(gvr, c.Namespace, name); err != nil {
+		return err
+	}
+	if cnrmscheme.Scheme.Recognizes(gvk) {
+		return c.CNRM.Tracker().Delete(gvr, c.Namespace, name)
+	}
+	return nil
+}
+
+func (c *Cluster) get(kind k8s.DependencyType, name string) (*unstructured.Unstructured, error) {
+	gvk, ok := k8s.LookupKind(kind)
+	if !ok {
+		return nil, fmt.Errorf("kind %s is not registered", kind)
+	}
+	obj, err := c.Dynamic.Tracker().Get(resource(gvk), c.Namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*unstructured.Unstructured).DeepCopy(), nil
+}
+
+// write stores u in the dynamic clientset and, for kinds the generated
+// clientset knows, a typed copy in the Config Connector clientset. Each
+// write gets a new resourceVersion as it would from the API server, and is
+// made under c.mu so lists and watches see both copies or neither.
+func (c *Cluster) write(u *unstructured.Unstructured, create bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resourceVersion++
+	u.SetResourceVersion(strconv.Itoa(c.resourceVersion))
+
+	gvk := u.GroupVersionKind()
+	gvr := resource(gvk)
+
+	var typed runtime.Object
+	if cnrmscheme.Scheme.Recognizes(gvk) {
+		obj, err := cnrmscheme.Scheme.New(gvk)
+		if err != nil {
+			return err
+		}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, obj); err != nil {
+			return err
+		}
+		typed = obj
+	}
+
+	if create {
+		if err := c.Dynamic.Tracker().Create(gvr, u, c.Namespace); err != nil {
+			return err
+		}
+		if typed != nil {
+			return c.CNRM.Tracker().Create(gvr, typed, c.Namespace)
+		}
+		return nil
+	}
+
+	if err := c.Dynamic.Tracker().Update(gvr, u, c.Namespace); err != nil {
+		return err
+	}
+	if typed != nil {
+		return c.CNRM.Tracker().Update(gvr, typed, c.Namespace)
+	}
+	return nil
+}
+
+// applyReactor serves server-side apply patches to the Config Connector
+// clientset, which the fake tracker can't create objects with. The applied
+// spec replaces the stored one, bumping the generation when it changes, and
+// the result is written to both clientsets like any other change.
+func (c *Cluster) applyReactor() k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch, ok := action.(k8stesting.PatchAction)
+		if !ok || patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		applied := &unstructured.Unstructured{}
+		if err := json.Unmarshal(patch.GetPatch(), &applied.Object); err != nil {
+			return true, nil, err
+		}
+		namespace := c.InNamespace(patch.GetNamespace())
+		gvr := resource(applied.GroupVersionKind())
+
+		obj, err := c.Dynamic.Tracker().Get(gvr, patch.GetNamespace(), patch.GetName())
+		switch {
+		case apierrors.IsNotFound(err):
+			applied.SetGeneration(1)
+			err = namespace.write(applied, true)
+		case err != nil:
+		default:
+			existing := obj.(*unstructured.Unstructured).DeepCopy()
+			if !equality.Semantic.DeepEqual(existing.Object["spec"], applied.Object["spec"]) {
+				existing.Object["spec"] = applied.Object["spec"]
+				existing.SetGeneration(existing.GetGeneration() + 1)
+			}
+			err = namespace.write(existing, false)
+		}
+		if err != nil {
+			return true, nil, err
+		}
+		typed, err := c.CNRM.Tracker().Get(gvr, patch.GetNamespace(), patch.GetName())
+		return true, typed, err
+	}
+}
+
+// Step is one scripted change to the cluster, made After the previous step.
+type Step struct {
+	After time.Duration
+	Kind  k8s.DependencyType
+	Name  string
+	// Namespace defaults to the cluster's.
+	Namespace string
+	// Reason sets the Ready condition, see SetReady.
+	Reason  string
+	Message string
+	// Delete removes the resource instead.
+	Delete bool
+	// DropWatches ends every open watch instead.
+	DropWatches bool
+	// Rollout completes the rollout of the Deployment called Name instead.
+	Rollout bool
+}
+
+// Transition returns steps that move a resource through reasons, one every
+// interval, e.g. UpdateFailed, Updating, UpToDate.
+func Transition(kind k8s.DependencyType, name string, interval time.Duration, reasons ...string) []Step {
+	steps := make([]Step, 0, len(reasons))
+	for _, reason := range reasons {
+		steps = append(steps, Step{After: interval, Kind: kind, Name: name, Reason: reason})
+	}
+	return steps
+}
+
+// Play makes each change in order and returns the first error.
+func (c *Cluster) Play(ctx context.Context, steps ...Step) error {
+	for _, step := range steps {
+		select {
+		case <-time.After(step.After):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		target := c
+		if step.Namespace != "" {
+			target = c.InNamespace(step.Namespace)
+		}
+
+		var err error
+		switch {
+		case step.DropWatches:
+			c.DropWatches()
+		case step.Rollout:
+			err = target.CompleteRollout(step.Name)
+		case step.Delete:
+			err = target.Delete(step.Kind, step.Name)
+		default:
+			err = target.SetReady(step.Kind, step.Name, step.Reason, step.Message)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", step.Kind, step.Name, err)
+		}
+	}
+	return nil
+}
+
+// Start plays the steps in the background. The channel receives the result
+// of Play.
+func (c *Cluster) Start(ctx context.Context, steps ...Step) <-chan error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Play(ctx, steps...)
+	}()
+	return errs
+}
+
+// kindOf returns the kind of a Config Connector or Kubernetes resource, or
+// the empty kind when it is neither.
+func kindOf(gvr schema.GroupVersionResource) schema.GroupVersionKind {
+	for _, gvk := range k8s.Kinds() {
+		if resource(gvk) == gvr {
+			return gvk
+		}
+	}
+	for gvk := range kubescheme.Scheme.AllKnownTypes() {
+		if gvk.GroupVersion() == gvr.GroupVersion() && resource(gvk) == gvr {
+			return gvk
+		}
+	}
+	return schema.GroupVersionKind{}
+}
+
+func resource(gvk schema.GroupVersionKind) schema.GroupVersionResource {
+	gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+	return gvr
+}
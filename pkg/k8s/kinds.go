@@ -0,0 +1,111 @@
+package k8s
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Config Connector kinds that can be referred to by DependencyType alone.
+// Anything else can be waited on by giving the apiVersion as well, or by
+// adding it with RegisterKind.
+var (
+	RedisInstance       DependencyType = "RedisInstance"
+	PubSubTopic         DependencyType = "PubSubTopic"
+	PubSubSubscription  DependencyType = "PubSubSubscription"
+	IAMServiceAccount   DependencyType = "IAMServiceAccount"
+	IAMPolicyMember     DependencyType = "IAMPolicyMember"
+	IAMPartialPolicy    DependencyType = "IAMPartialPolicy"
+	StorageBucket       DependencyType = "StorageBucket"
+	SecretManagerSecret DependencyType = "SecretManagerSecret"
+	ComputeAddress      DependencyType = "ComputeAddress"
+)
+
+var (
+	kindsMu sync.RWMutex
+	kinds   = map[DependencyType]schema.GroupVersionKind{
+		SqlResourceInstance: {Group: "sql.cnrm.cloud.google.com", Version: "v1beta1", Kind: "SQLInstance"},
+		SqlResourceDatabase: {Group: "sql.cnrm.cloud.google.com", Version: "v1beta1", Kind: "SQLDatabase"},
+		SqlResourceUser:     {Group: "sql.cnrm.cloud.google.com", Version: "v1beta1", Kind: "SQLUser"},
+		RedisInstance:       {Group: "redis.cnrm.cloud.google.com", Version: "v1beta1", Kind: "RedisInstance"},
+		PubSubTopic:         {Group: "pubsub.cnrm.cloud.google.com", Version: "v1beta1", Kind: "PubSubTopic"},
+		PubSubSubscription:  {Group: "pubsub.cnrm.cloud.google.com", Version: "v1beta1", Kind: "PubSubSubscription"},
+		IAMServiceAccount:   {Group: "iam.cnrm.cloud.google.com", Version: "v1beta1", Kind: "IAMServiceAccount"},
+		IAMPolicyMember:     {Group: "iam.cnrm.cloud.google.com", Version: "v1beta1", Kind: "IAMPolicyMember"},
+		IAMPartialPolicy:    {Group: "iam.cnrm.cloud.google.com", Version: "v1beta1", Kind: "IAMPartialPolicy"},
+		StorageBucket:       {Group: "storage.cnrm.cloud.google.com", Version: "v1beta1", Kind: "StorageBucket"},
+		SecretManagerSecret: {Group: "secretmanager.cnrm.cloud.google.com", Version: "v1beta1", Kind: "SecretManagerSecret"},
+		ComputeAddress:      {Group: "compute.cnrm.cloud.google.com", Version: "v1beta1", Kind: "ComputeAddress"},
+	}
+)
+
+// RegisterKind makes a Config Connector kind available to manifests by
+// DependencyType, replacing any earlier registration.
+func RegisterKind(t DependencyType, gvk schema.GroupVersionKind) {
+	kindsMu.Lock()
+	defer kindsMu.Unlock()
+	kinds[t] = gvk
+}
+
+// LookupKind returns the registered GroupVersionKind for t.
+func LookupKind(t DependencyType) (schema.GroupVersionKind, bool) {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	gvk, ok := kinds[t]
+	return gvk, ok
+}
+
+// Kinds returns a copy of every registered kind.
+func Kinds() map[DependencyType]schema.GroupVersionKind {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	out := make(map[DependencyType]schema.GroupVersionKind, len(kinds))
+	for t, gvk := range kinds {
+		out[t] = gvk
+	}
+	return out
+}
+
+// mustLookupKind is LookupKind for the kinds registered in this package.
+func mustLookupKind(t DependencyType) schema.GroupVersionKind {
+	gvk, ok := LookupKind(t)
+	if !ok {
+		panic(fmt.Sprintf("kind %s is not registered", t))
+	}
+	return gvk
+}
+
+// kindResource returns the REST resource for a Config Connector kind. KCC
+// CRDs are all named after the lowercase plural of their kind.
+func kindResource(gvk schema.GroupVersionKind) schema.GroupVersionResource {
+	gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+	return gvr
+}
+
+// unstructuredConditions reads status.conditions from any Config Connector
+// resource.
+func unstructuredConditions(u *unstructured.Unstructured) ([]v1alpha1.Condition, error) {
+	items, found, err := unstructured.NestedSlice(u.Object, "status", "conditions")
+	if err != nil || !found {
+		return nil, err
+	}
+
+	conditions := make([]v1alpha1.Condition, 0, len(items))
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s %s: malformed status.conditions", u.GetKind(), u.GetName())
+		}
+		var condition v1alpha1.Condition
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &condition); err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions, nil
+}
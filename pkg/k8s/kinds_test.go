@@ -0,0 +1,56 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestKindResource(t *testing.T) {
+	tests := map[DependencyType]string{
+		SqlResourceInstance: "sqlinstances",
+		IAMPolicyMember:     "iampolicymembers",
+		ComputeAddress:      "computeaddresses",
+		PubSubSubscription:  "pubsubsubscriptions",
+	}
+	for kind, resource := range tests {
+		gvk, ok := LookupKind(kind)
+		assert.True(t, ok, "%s should be registered", kind)
+		assert.Equal(t, resource, kindResource(gvk).Resource)
+	}
+}
+
+func TestKccResourceGroupVersionKind(t *testing.T) {
+	gvk, err := (&KccResource{Kind: "DNSRecordSet", APIVersion: "dns.cnrm.cloud.google.com/v1beta1", Name: "a"}).GroupVersionKind()
+	assert.NoError(t, err)
+	assert.Equal(t, schema.GroupVersionKind{Group: "dns.cnrm.cloud.google.com", Version: "v1beta1", Kind: "DNSRecordSet"}, gvk)
+
+	_, err = (&KccResource{Kind: "DNSRecordSet", Name: "a"}).GroupVersionKind()
+	assert.Error(t, err)
+
+	RegisterKind("DNSRecordSet", gvk)
+	_, err = (&KccResource{Kind: "DNSRecordSet", Name: "a"}).GroupVersionKind()
+	assert.NoError(t, err)
+}
+
+func TestProcessUnstructuredEvent(t *testing.T) {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "redis.cnrm.cloud.google.com/v1beta1",
+		"kind":       "RedisInstance",
+		"metadata":   map[string]interface{}{"name": "cache"},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "True", "reason": "UpToDate"},
+			},
+		},
+	}}
+
+	group := &SqlInstanceGroup{}
+	event, healthy := group.processEvent(SqlInstanceGroupEvent{Type: RedisInstance, Name: "cache"}, watch.Event{Type: watch.Modified, Object: u})
+	assert.True(t, healthy)
+	assert.Equal(t, "UpToDate", event.Condition.Reason)
+	assert.Equal(t, StateReady, event.State)
+}
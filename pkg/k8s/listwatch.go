@@ -0,0 +1,210 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	toolsWatch "k8s.io/client-go/tools/watch"
+)
+
+// listWatcher implements list-then-watch. It lists first, hands out every
+// listed object as an Added event and then watches from the list's
+// resourceVersion with a RetryWatcher, so nothing is missed or replayed.
+// Bookmarks keep the resourceVersion fresh while nothing changes, and when
+// it expires anyway (410 Gone) the list is taken again and the difference
+// to what was last seen is sent as Added, Modified and Deleted events.
+type listWatcher struct {
+	ctx    context.Context
+	lw     cache.ListerWatcher
+	result chan watch.Event
+	done   chan struct{}
+	once   sync.Once
+
+	// known is the last seen state of each object by namespace/name.
+	known map[string]runtime.Object
+}
+
+var _ watch.Interface = &listWatcher{}
+
+// newListWatcher takes the initial list straight away so that errors such
+// as a missing CRD or RBAC are returned to the caller rather than retried.
+func newListWatcher(ctx context.Context, lw cache.ListerWatcher) (watch.Interface, error) {
+	w := &listWatcher{
+		ctx:    ctx,
+		lw:     lw,
+		result: make(chan watch.Event),
+		done:   make(chan struct{}),
+		known:  make(map[string]runtime.Object),
+	}
+
+	items, resourceVersion, err := w.list()
+	if err != nil {
+		return nil, err
+	}
+	go w.run(items, resourceVersion)
+	return w, nil
+}
+
+func (w *listWatcher) list() ([]runtime.Object, string, error) {
+	list, err := w.lw.List(metav1.ListOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	listMeta, err := meta.ListAccessor(list)
+	if err != nil {
+		return nil, "", err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, "", err
+	}
+	return items, listMeta.GetResourceVersion(), nil
+}
+
+func (w *listWatcher) run(items []runtime.Object, resourceVersion string) {
+	defer close(w.result)
+
+	for {
+		if !w.sync(items) {
+			return
+		}
+
+		gone, err := w.watch(resourceVersion)
+		if err != nil {
+			w.sendError(err)
+			return
+		}
+		if !gone {
+			return
+		}
+
+		items, resourceVersion, err = w.list()
+		if err != nil {
+			w.sendError(err)
+			return
+		}
+	}
+}
+
+// sync sends the difference between the listed items and what was seen
+// before. On the first list every item is new.
+func (w *listWatcher) sync(items []runtime.Object) bool {
+	listed := make(map[string]bool, len(items))
+	for _, obj := range items {
+		key, err := cache.MetaNamespaceKeyFunc(obj)
+		if err != nil {
+			continue
+		}
+		listed[key] = true
+
+		eventType := watch.Added
+		if prev, ok := w.known[key]; ok {
+			if resourceVersionOf(prev) == resourceVersionOf(obj) {
+				continue
+			}
+			eventType = watch.Modified
+		}
+		if !w.send(watch.Event{Type: eventType, Object: obj}) {
+			return false
+		}
+	}
+
+	for key, obj := range w.known {
+		if !listed[key] {
+			if !w.send(watch.Event{Type: watch.Deleted, Object: obj}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// watch forwards events until the watch ends. It reports whether the
+// resourceVersion expired, in which case the caller lists again.
+func (w *listWatcher) watch(resourceVersion string) (bool, error) {
+	rw, err := toolsWatch.NewRetryWatcher(resourceVersion, &cache.ListWatch{
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.AllowWatchBookmarks = true
+			return w.lw.Watch(options)
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	defer rw.Stop()
+
+	for {
+		select {
+		case e, ok := <-rw.ResultChan():
+			if !ok {
+				return false, nil
+			}
+			if e.Type == watch.Error {
+				err := apierrors.FromObject(e.Object)
+				if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+					return true, nil
+				}
+				return false, err
+			}
+			if !w.send(e) {
+				return false, nil
+			}
+		case <-w.done:
+			return false, nil
+		case <-w.ctx.Done():
+			return false, nil
+		}
+	}
+}
+
+func (w *listWatcher) send(e watch.Event) bool {
+	if key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(e.Object); err == nil {
+		if e.Type == watch.Deleted {
+			delete(w.known, key)
+		} else {
+			w.known[key] = e.Object
+		}
+	}
+
+	select {
+	case w.result <- e:
+		return true
+	case <-w.done:
+		return false
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+func (w *listWatcher) sendError(err error) {
+	status := apierrors.NewInternalError(fmt.Errorf("list-watch: %w", err)).ErrStatus
+	if apiStatus, ok := err.(apierrors.APIStatus); ok {
+		status = apiStatus.Status()
+	}
+	w.send(watch.Event{Type: watch.Error, Object: &status})
+}
+
+func (w *listWatcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *listWatcher) Stop() {
+	w.once.Do(func() {
+		close(w.done)
+	})
+}
+
+func resourceVersionOf(obj runtime.Object) string {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return ""
+	}
+	return m.GetResourceVersion()
+}
@@ -0,0 +1,146 @@
+package k8s
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// scriptedListWatch serves lists from a queue and records the options each
+// watch was started with.
+type scriptedListWatch struct {
+	mu       sync.Mutex
+	lists    []*unstructured.UnstructuredList
+	watchers chan *watch.FakeWatcher
+	watches  []metav1.ListOptions
+}
+
+func (s *scriptedListWatch) listWatch() *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			list := s.lists[0]
+			s.lists = s.lists[1:]
+			return list, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			s.mu.Lock()
+			s.watches = append(s.watches, options)
+			s.mu.Unlock()
+			w := watch.NewFake()
+			s.watchers <- w
+			return w, nil
+		},
+	}
+}
+
+func newTestList(resourceVersion string, items ...*unstructured.Unstructured) *unstructured.UnstructuredList {
+	list := &unstructured.UnstructuredList{}
+	list.SetResourceVersion(resourceVersion)
+	for _, item := range items {
+		list.Items = append(list.Items, *item)
+	}
+	return list
+}
+
+func withResourceVersion(u *unstructured.Unstructured, resourceVersion string) *unstructured.Unstructured {
+	u.SetResourceVersion(resourceVersion)
+	return u
+}
+
+func nextEvent(t *testing.T, w watch.Interface) watch.Event {
+	t.Helper()
+	select {
+	case e := <-w.ResultChan():
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return watch.Event{}
+}
+
+func TestListWatcherResumesFromList(t *testing.T) {
+	s := &scriptedListWatch{
+		lists:    []*unstructured.UnstructuredList{newTestList("10", withResourceVersion(newTestDatabase("db-1", "instance-1"), "9"))},
+		watchers: make(chan *watch.FakeWatcher, 1),
+	}
+
+	w, err := newListWatcher(context.TODO(), s.listWatch())
+	require.NoError(t, err)
+	defer w.Stop()
+
+	e := nextEvent(t, w)
+	assert.Equal(t, watch.Added, e.Type)
+	assert.Equal(t, "db-1", e.Object.(*unstructured.Unstructured).GetName())
+
+	fw := <-s.watchers
+	fw.Modify(withResourceVersion(newTestDatabase("db-1", "instance-1"), "11"))
+	assert.Equal(t, watch.Modified, nextEvent(t, w).Type)
+
+	s.mu.Lock()
+	assert.Equal(t, "10", s.watches[0].ResourceVersion)
+	assert.True(t, s.watches[0].AllowWatchBookmarks)
+	s.mu.Unlock()
+}
+
+func TestListWatcherRelistsOnGone(t *testing.T) {
+	s := &scriptedListWatch{
+		lists: []*unstructured.UnstructuredList{
+			newTestList("10",
+				withResourceVersion(newTestDatabase("db-1", "instance-1"), "8"),
+				withResourceVersion(newTestDatabase("db-2", "instance-1"), "9")),
+			newTestList("20",
+				withResourceVersion(newTestDatabase("db-1", "instance-1"), "15"),
+				withResourceVersion(newTestDatabase("db-3", "instance-1"), "16")),
+		},
+		watchers: make(chan *watch.FakeWatcher, 2),
+	}
+
+	w, err := newListWatcher(context.TODO(), s.listWatch())
+	require.NoError(t, err)
+	defer w.Stop()
+
+	assert.Equal(t, watch.Added, nextEvent(t, w).Type)
+	assert.Equal(t, watch.Added, nextEvent(t, w).Type)
+
+	gone := apierrors.NewResourceExpired("too old resource version").ErrStatus
+	(<-s.watchers).Error(&gone)
+
+	got := map[string]watch.EventType{}
+	for i := 0; i < 3; i++ {
+		e := nextEvent(t, w)
+		got[e.Object.(*unstructured.Unstructured).GetName()] = e.Type
+	}
+	assert.Equal(t, map[string]watch.EventType{
+		"db-1": watch.Modified,
+		"db-2": watch.Deleted,
+		"db-3": watch.Added,
+	}, got)
+
+	<-s.watchers
+	s.mu.Lock()
+	assert.Equal(t, "20", s.watches[1].ResourceVersion)
+	s.mu.Unlock()
+}
+
+func TestListWatcherListError(t *testing.T) {
+	lw := &cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			return nil, apierrors.NewForbidden(schema.GroupResource{Resource: "sqldatabases"}, "", nil)
+		},
+	}
+	_, err := newListWatcher(context.TODO(), lw)
+	assert.True(t, apierrors.IsForbidden(err))
+}
@@ -0,0 +1,101 @@
+package k8s
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Attribute keys every log line about a resource carries.
+const (
+	logKeyGroup     = "group"
+	logKeyKind      = "kind"
+	logKeyName      = "name"
+	logKeyNamespace = "namespace"
+	logKeyCluster   = "cluster"
+	logKeyReason    = "reason"
+	logKeyAttempt   = "attempt"
+	logKeyElapsed   = "elapsed"
+)
+
+// WithLogger sends the application's logs to logger instead of
+// slog.Default. Logs are kept apart from the status output of the Printer.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *appOptions) {
+		o.logger = logger
+	}
+}
+
+// SetLogger replaces the logger, for applications not created with New.
+func (app *Application) SetLogger(logger *slog.Logger) {
+	app.logger = logger
+}
+
+// Logger returns the logger the application logs to, so that callers can
+// log alongside it.
+func (app *Application) Logger() *slog.Logger {
+	return app.log()
+}
+
+func (app *Application) log() *slog.Logger {
+	if app.logger == nil {
+		return slog.Default()
+	}
+	return app.logger
+}
+
+// resourceLogger returns a logger carrying the group, kind, name, namespace
+// and, when it isn't the current one, cluster of an event's resource.
+func (app *Application) resourceLogger(e SqlInstanceGroupEvent) *slog.Logger {
+	group := ""
+	if e.Group != nil {
+		group = e.Group.Name
+	}
+	attrs := []any{
+		logKeyGroup, group,
+		logKeyKind, string(e.Type),
+		logKeyName, e.Name,
+		logKeyNamespace, e.Namespace,
+	}
+	if e.Cluster != "" {
+		attrs = append(attrs, logKeyCluster, e.Cluster)
+	}
+	return app.log().With(attrs...)
+}
+
+// logEvent logs a state update at a level by how it went: progress is
+// debug detail, a ready resource is info and anything else a warning.
+func (app *Application) logEvent(e SqlInstanceGroupEvent, started time.Time) {
+	level := slog.LevelWarn
+	switch e.State {
+	case StatePending:
+		level = slog.LevelDebug
+	case StateReady:
+		level = slog.LevelInfo
+	}
+
+	attrs := []any{logKeyElapsed, e.Time.Sub(started).Round(time.Millisecond)}
+	if e.Condition != nil {
+		attrs = append(attrs, logKeyReason, e.Condition.Reason)
+	}
+	if e.Error != nil {
+		attrs = append(attrs, "error", e.Error.Error())
+	}
+	app.resourceLogger(e).Log(context.Background(), level, "resource "+stateVerb(e.State), attrs...)
+}
+
+func stateVerb(state ResourceState) string {
+	switch state {
+	case StatePending:
+		return "progressing"
+	case StateReady:
+		return "ready"
+	case StateFailed:
+		return "failed"
+	case StateTimedOut:
+		return "timed out"
+	case StateSkipped:
+		return "skipped"
+	}
+	return string(state)
+}
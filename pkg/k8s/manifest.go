@@ -0,0 +1,279 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// SqlManifest describes the Cloud SQL resources to wait on, along with any
+// other Config Connector resources, and the workloads to roll out once they
+// are ready. It is read from YAML or JSON and mirrors
+// the shape of the SqlInstance, SqlDatabase, SqlUser and KccResource types.
+type SqlManifest struct {
+	Instances []SqlInstance `yaml:"instances" json:"instances"`
+	Databases []SqlDatabase `yaml:"databases" json:"databases"`
+	Users     []SqlUser     `yaml:"users" json:"users"`
+	Resources []KccResource `yaml:"resources,omitempty" json:"resources,omitempty"`
+	Workloads []Workload    `yaml:"workloads,omitempty" json:"workloads,omitempty"`
+	Timeouts  *Timeouts     `yaml:"timeouts,omitempty" json:"timeouts,omitempty"`
+}
+
+// LoadManifestFile reads a manifest from path, or from stdin when path is "-".
+func LoadManifestFile(path string) (*SqlManifest, error) {
+	if path == "-" {
+		m, err := LoadManifest(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("manifest <stdin>: %w", err)
+		}
+		return m, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", path, err)
+	}
+	defer f.Close()
+
+	m, err := LoadManifest(f)
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// LoadManifest decodes and validates a manifest. Unknown fields are rejected
+// so that typos don't silently drop resources.
+func LoadManifest(r io.Reader) (*SqlManifest, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &SqlManifest{}
+	if err := yaml.UnmarshalStrict(data, m); err != nil {
+		return nil, err
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Validate reports every problem in the manifest at once: empty or duplicate
+// names, unknown kinds, and resources that reference an unknown or ambiguous
+// instance, and workloads with unknown dependencies or a dependency cycle.
+// Names only have to be unique within a namespace and cluster.
+func (m *SqlManifest) Validate() error {
+	var errs []error
+
+	if len(m.Instances) == 0 && len(m.Resources) == 0 {
+		errs = append(errs, errors.New("no instances or resources defined"))
+	}
+	if m.Timeouts != nil {
+		errs = append(errs, m.Timeouts.validate()...)
+	}
+
+	instances := make(map[string]bool, len(m.Instances))
+	for i, instance := range m.Instances {
+		key := manifestKey(instance.Cluster, instance.Namespace, instance.Name)
+		switch {
+		case instance.Name == "":
+			errs = append(errs, fmt.Errorf("instances[%d]: name is required", i))
+		case instances[key]:
+			errs = append(errs, fmt.Errorf("instances[%d]: duplicate instance %q", i, instance.Name))
+		}
+		instances[key] = true
+		if instance.Timeout != nil && instance.Timeout.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("instances[%d]: timeout must be positive, got %s", i, instance.Timeout.Duration))
+		}
+	}
+
+	databases := make(map[string]bool, len(m.Databases))
+	for i, database := range m.Databases {
+		key := manifestKey(database.Cluster, database.Namespace, database.Name)
+		switch {
+		case database.Name == "":
+			errs = append(errs, fmt.Errorf("databases[%d]: name is required", i))
+		case databases[key]:
+			errs = append(errs, fmt.Errorf("databases[%d]: duplicate database %q", i, database.Name))
+		}
+		databases[key] = true
+
+		if err := m.checkInstanceRef(database.InstanceName, database.Cluster, database.Namespace); err != nil {
+			errs = append(errs, fmt.Errorf("databases[%d]: database %q %w", i, database.Name, err))
+		}
+	}
+
+	users := make(map[string]bool, len(m.Users))
+	for i, user := range m.Users {
+		key := manifestKey(user.Cluster, user.Namespace, user.Name)
+		switch {
+		case user.Name == "":
+			errs = append(errs, fmt.Errorf("users[%d]: name is required", i))
+		case users[key]:
+			errs = append(errs, fmt.Errorf("users[%d]: duplicate user %q", i, user.Name))
+		}
+		users[key] = true
+
+		if err := m.checkInstanceRef(user.InstanceName, user.Cluster, user.Namespace); err != nil {
+			errs = append(errs, fmt.Errorf("users[%d]: user %q %w", i, user.Name, err))
+		}
+	}
+
+	resources := make(map[string]bool, len(m.Resources))
+	for i, resource := range m.Resources {
+		key := string(resource.Kind) + "/" + resource.Name
+		switch {
+		case resource.Kind == "":
+			errs = append(errs, fmt.Errorf("resources[%d]: kind is required", i))
+		case resource.Name == "":
+			errs = append(errs, fmt.Errorf("resources[%d]: name is required", i))
+		case resources[manifestKey(resource.Cluster, resource.Namespace, key)]:
+			errs = append(errs, fmt.Errorf("resources[%d]: duplicate resource %q", i, key))
+		}
+		resources[manifestKey(resource.Cluster, resource.Namespace, key)] = true
+
+		if resource.Kind != "" {
+			if _, err := resource.GroupVersionKind(); err != nil {
+				errs = append(errs, fmt.Errorf("resources[%d]: %w", i, err))
+			}
+		}
+		if resource.InstanceName != "" {
+			if err := m.checkInstanceRef(resource.InstanceName, resource.Cluster, resource.Namespace); err != nil {
+				errs = append(errs, fmt.Errorf("resources[%d]: resource %q %w", i, key, err))
+			}
+		}
+	}
+
+	workloads := make([]*Workload, len(m.Workloads))
+	seen := make(map[string]bool, len(m.Workloads))
+	for i := range m.Workloads {
+		workload := &m.Workloads[i]
+		workloads[i] = workload
+		key := manifestKey(workload.Cluster, workload.Namespace, workload.ref())
+		switch {
+		case !isWorkloadKind(workload.Kind):
+			errs = append(errs, fmt.Errorf("workloads[%d]: kind must be %s, %s or %s",
+				i, WorkloadDeployment, WorkloadStatefulSet, WorkloadDaemonSet))
+		case workload.Name == "":
+			errs = append(errs, fmt.Errorf("workloads[%d]: name is required", i))
+		case seen[key]:
+			errs = append(errs, fmt.Errorf("workloads[%d]: duplicate workload %q", i, workload.ref()))
+		}
+		seen[key] = true
+
+		for _, dep := range workload.DependsOn {
+			if err := m.checkDependency(workload, dep); err != nil {
+				errs = append(errs, fmt.Errorf("workloads[%d]: workload %q %w", i, workload.ref(), err))
+			}
+		}
+	}
+	if cycle := newWorkloadGraph(workloads).cycle(); cycle != nil {
+		errs = append(errs, cycleError(workloads, cycle))
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkDependency makes sure a workload dependency names exactly one
+// instance, or one other workload as Kind/name.
+func (m *SqlManifest) checkDependency(w *Workload, dep string) error {
+	kind, name, ok := splitWorkloadRef(dep)
+	if !ok {
+		return m.checkInstanceRef(dep, w.Cluster, w.Namespace)
+	}
+
+	matches := 0
+	for i := range m.Workloads {
+		if w.matches(kind, name, &m.Workloads[i]) {
+			matches++
+		}
+	}
+	switch {
+	case matches == 0:
+		return fmt.Errorf("depends on unknown workload %q", dep)
+	case matches > 1:
+		return fmt.Errorf("depends on workload %q, which is ambiguous; set its namespace", dep)
+	}
+	return nil
+}
+
+func manifestKey(cluster, namespace, name string) string {
+	return cluster + "/" + namespace + "/" + name
+}
+
+// checkInstanceRef makes sure a database, user or resource belongs to exactly
+// one instance: the one with that name in the same cluster, and in the same
+// namespace when one is given.
+func (m *SqlManifest) checkInstanceRef(name, cluster, namespace string) error {
+	matches := 0
+	for _, instance := range m.Instances {
+		if instance.Name == name && instance.Cluster == cluster &&
+			(namespace == "" || instance.Namespace == "" || instance.Namespace == namespace) {
+			matches++
+		}
+	}
+	switch {
+	case matches == 0:
+		return fmt.Errorf("references unknown instance %q", name)
+	case matches > 1:
+		return fmt.Errorf("references instance %q, which is ambiguous; set its namespace", name)
+	}
+	return nil
+}
+
+// clusters returns every cluster the manifest refers to other than the
+// current one.
+func (m *SqlManifest) clusters() []string {
+	var clusters []string
+	seen := map[string]bool{"": true}
+	add := func(cluster string) {
+		if !seen[cluster] {
+			seen[cluster] = true
+			clusters = append(clusters, cluster)
+		}
+	}
+	for _, instance := range m.Instances {
+		add(instance.Cluster)
+	}
+	for _, resource := range m.Resources {
+		add(resource.Cluster)
+	}
+	for _, workload := range m.Workloads {
+		add(workload.Cluster)
+	}
+	return clusters
+}
+
+// InitGroupsFromManifest populates the group list from a validated manifest.
+func (s *SqlInstanceGroupList) InitGroupsFromManifest(m *SqlManifest) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	for _, cluster := range m.clusters() {
+		if _, err := s.app.Cluster(cluster); err != nil {
+			return err
+		}
+	}
+	s.Timeouts = s.app.waitTimeouts(m)
+	for _, instance := range m.Instances {
+		s.AddInstance(instance)
+	}
+	for _, database := range m.Databases {
+		s.AddDatabase(database)
+	}
+	for _, user := range m.Users {
+		s.AddUser(user)
+	}
+	for _, resource := range m.Resources {
+		s.AddResource(resource)
+	}
+	for _, workload := range m.Workloads {
+		s.AddWorkload(workload)
+	}
+	return nil
+}
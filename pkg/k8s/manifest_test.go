@@ -0,0 +1,176 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testManifest = `
+instances:
+- name: test-deployments-mysql-uno
+- name: test-deployments-mysql-dos
+databases:
+- name: td-uno-db
+  instanceName: test-deployments-mysql-uno
+users:
+- name: td-uno-user
+  instanceName: test-deployments-mysql-uno
+- name: td-dos-user
+  instanceName: test-deployments-mysql-dos
+`
+
+func TestLoadManifest(t *testing.T) {
+	m, err := LoadManifest(strings.NewReader(testManifest))
+	assert.NoError(t, err)
+
+	app := NewApp("")
+	sig := NewSqlInstanceGroupList(context.TODO(), app)
+	assert.NoError(t, sig.InitGroupsFromManifest(m))
+
+	assert.Equal(t, 2, len(sig.Groups), "groups length should match instances")
+	assert.Equal(t, 1, len(sig.GetGroup("test-deployments-mysql-uno").Databases))
+	assert.Equal(t, 1, len(sig.GetGroup("test-deployments-mysql-dos").Users))
+}
+
+func TestLoadManifestJSON(t *testing.T) {
+	m, err := LoadManifest(strings.NewReader(`{"instances": [{"name": "uno"}], "users": [{"name": "u", "instanceName": "uno"}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(m.Users))
+}
+
+func TestLoadManifestInvalid(t *testing.T) {
+	_, err := LoadManifest(strings.NewReader(`
+instances:
+- name: uno
+- name: uno
+databases:
+- name: db
+  instanceName: dos
+users:
+- name: ""
+  instanceName: uno
+`))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `duplicate instance "uno"`)
+	assert.Contains(t, err.Error(), `database "db" references unknown instance "dos"`)
+	assert.Contains(t, err.Error(), "users[0]: name is required")
+}
+
+func TestLoadManifestUnknownField(t *testing.T) {
+	_, err := LoadManifest(strings.NewReader(`
+instances:
+- name: uno
+  instance: typo
+`))
+	assert.Error(t, err)
+}
+
+func TestLoadManifestNamespacesAndClusters(t *testing.T) {
+	_, err := LoadManifest(strings.NewReader(`
+instances:
+- name: uno
+- name: uno
+  cluster: dr
+- name: dos
+  namespace: a
+- name: dos
+  namespace: b
+databases:
+- name: db
+  instanceName: uno
+- name: db
+  instanceName: uno
+  cluster: dr
+- name: dos-db
+  instanceName: dos
+  namespace: b
+`))
+	assert.NoError(t, err)
+
+	_, err = LoadManifest(strings.NewReader(`
+instances:
+- name: dos
+  namespace: a
+- name: dos
+  namespace: b
+users:
+- name: u
+  instanceName: dos
+- name: v
+  instanceName: dos
+  cluster: dr
+`))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `user "u" references instance "dos", which is ambiguous`)
+	assert.Contains(t, err.Error(), `user "v" references unknown instance "dos"`)
+}
+
+func TestLoadManifestTimeouts(t *testing.T) {
+	m, err := LoadManifest(strings.NewReader(`
+timeouts:
+  overall: 30m
+  kinds:
+    SqlInstance: 20m
+    SqlUser: 1m
+instances:
+- name: uno
+  timeout: 25m
+users:
+- name: u
+  instanceName: uno
+`))
+	assert.NoError(t, err)
+
+	app := newTestApp("default", nil, nil, nil)
+	sig := NewSqlInstanceGroupList(context.TODO(), app)
+	assert.NoError(t, sig.InitGroupsFromManifest(m))
+	assert.Equal(t, 30*time.Minute, sig.Timeouts.overall())
+	assert.Equal(t, time.Minute, sig.Timeouts.kind(SqlResourceUser))
+	assert.Equal(t, time.Duration(0), sig.Timeouts.kind(SqlResourceDatabase))
+	assert.Equal(t, 25*time.Minute, sig.GetGroup("uno").Timeout)
+
+	// timeouts set on the application take precedence, once
+	app.SetWaitTimeouts(Timeouts{Kinds: map[DependencyType]metav1.Duration{SqlResourceUser: {Duration: 2 * time.Minute}}})
+	sig = NewSqlInstanceGroupList(context.TODO(), app)
+	assert.NoError(t, sig.InitGroupsFromManifest(m))
+	assert.Equal(t, 30*time.Minute, sig.Timeouts.overall())
+	assert.Equal(t, 2*time.Minute, sig.Timeouts.kind(SqlResourceUser))
+	assert.Equal(t, 20*time.Minute, sig.Timeouts.kind(SqlResourceInstance))
+
+	_, err = LoadManifest(strings.NewReader(`
+timeouts:
+  overall: 0s
+  kinds:
+    SqlUser: -1m
+instances:
+- name: uno
+  timeout: 0s
+`))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "timeouts.overall: must be positive")
+	assert.Contains(t, err.Error(), "timeouts.kinds.SqlUser: must be positive")
+	assert.Contains(t, err.Error(), "instances[0]: timeout must be positive")
+}
+
+func TestTimeoutsMerge(t *testing.T) {
+	manifest := Timeouts{
+		Overall: &metav1.Duration{Duration: time.Hour},
+		Kinds: map[DependencyType]metav1.Duration{
+			SqlResourceInstance: {Duration: 20 * time.Minute},
+			SqlResourceUser:     {Duration: time.Minute},
+		},
+	}
+	merged := manifest.merge(Timeouts{Kinds: map[DependencyType]metav1.Duration{
+		SqlResourceUser: {Duration: 10 * time.Second},
+	}})
+
+	assert.Equal(t, time.Hour, merged.overall())
+	assert.Equal(t, 20*time.Minute, merged.kind(SqlResourceInstance))
+	assert.Equal(t, 10*time.Second, merged.kind(SqlResourceUser))
+	assert.Equal(t, DefaultWaitTimeout, Timeouts{}.overall())
+}
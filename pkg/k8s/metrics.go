@@ -0,0 +1,180 @@
+package k8s
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const metricsNamespace = "go_k8s"
+
+var resourceLabels = []string{"group", "kind", "name", "namespace", "cluster"}
+
+// Metrics exports the state of watched resources to Prometheus. Observe
+// feeds it the events of WaitForCloudSQL or MonitorCloudSQL, and passing it
+// to WithMetrics counts watch restarts and API errors.
+type Metrics struct {
+	ready            *prometheus.Desc
+	conditionSeconds *prometheus.Desc
+	flips            *prometheus.Desc
+	watchRestarts    *prometheus.CounterVec
+	apiErrors        *prometheus.CounterVec
+
+	mu        sync.Mutex
+	resources map[string]*resourceMetrics
+	now       func() time.Time
+}
+
+// resourceMetrics is what is known about a resource from its last event.
+type resourceMetrics struct {
+	labels []string
+	ready  bool
+	state  string
+	reason string
+	since  time.Time
+	flips  int
+}
+
+var _ prometheus.Collector = &Metrics{}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		ready: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "resource", "ready"),
+			"Whether the resource is ready (1) or not (0).",
+			resourceLabels, nil),
+		conditionSeconds: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "resource", "condition_seconds"),
+			"How long the resource has been in its current state and reason.",
+			append(resourceLabels, "state", "reason"), nil),
+		flips: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "resource", "state_flips_total"),
+			"How many times the resource has changed between states.",
+			resourceLabels, nil),
+		watchRestarts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "watch_restarts_total",
+			Help:      "Watches started again after failing or expiring.",
+		}, []string{"resource"}),
+		apiErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_errors_total",
+			Help:      "Failed list and watch requests to the API server.",
+		}, []string{"resource", "verb"}),
+		resources: make(map[string]*resourceMetrics),
+		now:       time.Now,
+	}
+}
+
+// Observe records an event. Events that don't carry a state, such as a
+// resource still waiting for its first status, are ignored.
+func (m *Metrics) Observe(e SqlInstanceGroupEvent) {
+	state := eventState(e)
+	if state == "" {
+		return
+	}
+	reason := ""
+	if e.Condition != nil {
+		reason = e.Condition.Reason
+	}
+	now := e.Time
+	if now.IsZero() {
+		now = m.now()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := reportKey(e)
+	r, ok := m.resources[key]
+	if !ok {
+		group := ""
+		if e.Group != nil {
+			group = e.Group.Name
+		}
+		r = &resourceMetrics{
+			labels: []string{group, string(e.Type), e.Name, e.Namespace, e.Cluster},
+			state:  state,
+			reason: reason,
+			since:  now,
+		}
+		m.resources[key] = r
+	}
+	if r.state != state {
+		r.flips++
+	}
+	if r.state != state || r.reason != reason {
+		r.state = state
+		r.reason = reason
+		r.since = now
+	}
+	r.ready = e.State == StateReady
+}
+
+// eventState is the readiness the controller reports, or when the resource
+// couldn't be watched at all, the state the wait ended in.
+func eventState(e SqlInstanceGroupEvent) string {
+	if e.Readiness != "" {
+		return string(e.Readiness)
+	}
+	if e.State != StatePending {
+		return string(e.State)
+	}
+	return ""
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.ready
+	ch <- m.conditionSeconds
+	ch <- m.flips
+	m.watchRestarts.Describe(ch)
+	m.apiErrors.Describe(ch)
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.mu.Lock()
+	now := m.now()
+	for _, r := range m.resources {
+		ready := 0.0
+		if r.ready {
+			ready = 1
+		}
+		ch <- prometheus.MustNewConstMetric(m.ready, prometheus.GaugeValue, ready, r.labels...)
+		ch <- prometheus.MustNewConstMetric(m.conditionSeconds, prometheus.GaugeValue,
+			now.Sub(r.since).Seconds(), append(append([]string{}, r.labels...), r.state, r.reason)...)
+		ch <- prometheus.MustNewConstMetric(m.flips, prometheus.CounterValue, float64(r.flips), r.labels...)
+	}
+	m.mu.Unlock()
+
+	m.watchRestarts.Collect(ch)
+	m.apiErrors.Collect(ch)
+}
+
+// watchRestarted and apiError are called by the informers. Both are safe on
+// a nil *Metrics so that the informers don't have to check.
+func (m *Metrics) watchRestarted(gvr schema.GroupVersionResource) {
+	if m != nil {
+		m.watchRestarts.WithLabelValues(gvr.Resource).Inc()
+	}
+}
+
+func (m *Metrics) apiError(gvr schema.GroupVersionResource, verb string) {
+	if m != nil {
+		m.apiErrors.WithLabelValues(gvr.Resource, verb).Inc()
+	}
+}
+
+// WithMetrics counts watch restarts and API errors in m.
+func WithMetrics(m *Metrics) Option {
+	return func(o *appOptions) {
+		o.metrics = m
+	}
+}
+
+// SetMetrics counts watch restarts and API errors in m, for applications
+// not created with WithMetrics. It has to be called before anything is
+// watched.
+func (app *Application) SetMetrics(m *Metrics) {
+	app.metrics = m
+}
@@ -0,0 +1,108 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestMetricsObserve(t *testing.T) {
+	m := NewMetrics()
+	start := time.Now()
+	m.now = func() time.Time { return start.Add(10 * time.Minute) }
+
+	group := &SqlInstanceGroup{Name: "uno"}
+	event := func(readiness ReadinessState, reason string, at time.Duration) SqlInstanceGroupEvent {
+		state := StatePending
+		if readiness == ReadinessReady {
+			state = StateReady
+		}
+		return SqlInstanceGroupEvent{
+			Group:     group,
+			Type:      SqlResourceInstance,
+			Name:      "uno",
+			Namespace: "default",
+			Condition: &v1alpha1.Condition{Reason: reason},
+			Readiness: readiness,
+			State:     state,
+			Time:      start.Add(at),
+		}
+	}
+	m.Observe(event(ReadinessProgressing, ReasonUpdating, 0))
+	m.Observe(event(ReadinessReady, ReasonUpToDate, time.Minute))
+	m.Observe(event(ReadinessFailed, ReasonUpdateFailed, 2*time.Minute))
+	// repeated updates with the same reason don't reset the clock
+	m.Observe(event(ReadinessFailed, ReasonUpdateFailed, 5*time.Minute))
+	m.Observe(SqlInstanceGroupEvent{Group: group, Type: SqlResourceDatabase, Name: "uno-db", Namespace: "default", State: StatePending})
+	m.watchRestarted(schema.GroupVersionResource{Resource: "sqldatabases"})
+
+	expected := `
+# HELP go_k8s_resource_condition_seconds How long the resource has been in its current state and reason.
+# TYPE go_k8s_resource_condition_seconds gauge
+go_k8s_resource_condition_seconds{cluster="",group="uno",kind="SqlInstance",name="uno",namespace="default",reason="UpdateFailed",state="Failed"} 480
+# HELP go_k8s_resource_ready Whether the resource is ready (1) or not (0).
+# TYPE go_k8s_resource_ready gauge
+go_k8s_resource_ready{cluster="",group="uno",kind="SqlInstance",name="uno",namespace="default"} 0
+# HELP go_k8s_resource_state_flips_total How many times the resource has changed between states.
+# TYPE go_k8s_resource_state_flips_total counter
+go_k8s_resource_state_flips_total{cluster="",group="uno",kind="SqlInstance",name="uno",namespace="default"} 2
+# HELP go_k8s_watch_restarts_total Watches started again after failing or expiring.
+# TYPE go_k8s_watch_restarts_total counter
+go_k8s_watch_restarts_total{resource="sqldatabases"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(m, strings.NewReader(expected)))
+}
+
+func TestMetricsWatchRestarts(t *testing.T) {
+	m := NewMetrics()
+	_, gvr, client := newTestInformerCache()
+	watchers := make(chan *watch.FakeWatcher, 3)
+	client.PrependWatchReactor("*", func(clienttesting.Action) (bool, watch.Interface, error) {
+		w := watch.NewFake()
+		watchers <- w
+		return true, w, nil
+	})
+	lw := instrumentedListWatch(context.TODO(), client, gvr, "default", m)
+	restarts := func() float64 {
+		return testutil.ToFloat64(m.watchRestarts.WithLabelValues(gvr.Resource))
+	}
+
+	// a watch that the server ends after its timeout is started again routinely
+	w, err := lw.Watch(metav1.ListOptions{})
+	require.NoError(t, err)
+	(<-watchers).Stop()
+	for range w.ResultChan() {
+	}
+	timeout := int64(300)
+	w, err = lw.Watch(metav1.ListOptions{TimeoutSeconds: &timeout})
+	require.NoError(t, err)
+	assert.Zero(t, restarts())
+
+	// one that was dropped before its timeout is a restart
+	(<-watchers).Stop()
+	for range w.ResultChan() {
+	}
+	w, err = lw.Watch(metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, restarts())
+
+	// and so is one whose resourceVersion expired
+	go (<-watchers).Error(&apierrors.NewResourceExpired("too old").ErrStatus)
+	e := <-w.ResultChan()
+	assert.Equal(t, watch.Error, e.Type)
+	w.Stop()
+	_, err = lw.Watch(metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, restarts())
+}
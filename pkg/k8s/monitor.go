@@ -0,0 +1,209 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// monitorTarget is a resource MonitorCloudSQL watches.
+type monitorTarget struct {
+	group *SqlInstanceGroup
+	event SqlInstanceGroupEvent
+	gvk   schema.GroupVersionKind
+}
+
+// monitorTargets returns every instance, database, user and resource of the
+// groups. Workloads aren't Config Connector resources and are left out.
+func (s *SqlInstanceGroupList) monitorTargets() ([]monitorTarget, error) {
+	var targets []monitorTarget
+	for _, group := range append(s.Groups, s.Standalone) {
+		if !group.standalone {
+			targets = append(targets, monitorTarget{group, group.baseEvent(SqlResourceInstance, group.Name, "", ""), mustLookupKind(SqlResourceInstance)})
+		}
+		for _, db := range group.Databases {
+			targets = append(targets, monitorTarget{group, group.baseEvent(SqlResourceDatabase, db.Name, db.Namespace, ""), mustLookupKind(SqlResourceDatabase)})
+		}
+		for _, user := range group.Users {
+			targets = append(targets, monitorTarget{group, group.baseEvent(SqlResourceUser, user.Name, user.Namespace, ""), mustLookupKind(SqlResourceUser)})
+		}
+		for _, resource := range group.Resources {
+			gvk, err := resource.GroupVersionKind()
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", resource.Kind, resource.Name, err)
+			}
+			targets = append(targets, monitorTarget{group, group.baseEvent(resource.Kind, resource.Name, resource.Namespace, resource.Cluster), gvk})
+		}
+	}
+	return targets, nil
+}
+
+// MonitorCloudSQL watches every resource of the manifest, or the built-in
+// demo groups when manifest is nil, until ctx ends. Unlike WaitForCloudSQL
+// it keeps going once resources are ready or have failed, and calls handle
+// with each change, one at a time. A resource is Failed while its controller
+// reports a failing reason, while it is missing, and while it can't be
+// watched, which is retried.
+func (app *Application) MonitorCloudSQL(ctx context.Context, manifest *SqlManifest, handle func(SqlInstanceGroupEvent)) error {
+	groups := NewSqlInstanceGroupList(ctx, app)
+	if manifest == nil {
+		groups.InitGroups()
+	} else if err := groups.InitGroupsFromManifest(manifest); err != nil {
+		return err
+	}
+	targets, err := groups.monitorTargets()
+	if err != nil {
+		return err
+	}
+
+	events := make(chan SqlInstanceGroupEvent)
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target monitorTarget) {
+			defer wg.Done()
+			target.group.monitor(ctx, events, target.event, target.gvk)
+		}(target)
+	}
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	started := time.Now()
+	for e := range events {
+		app.logEvent(e, started)
+		handle(e)
+	}
+	for _, cluster := range app.allClusters() {
+		cluster.informers().stopAll()
+	}
+	return nil
+}
+
+// monitor sends an event whenever the state, reason or message of a
+// resource changes, until ctx ends.
+func (s *SqlInstanceGroup) monitor(ctx context.Context, events chan<- SqlInstanceGroupEvent, baseEvent SqlInstanceGroupEvent, gvk schema.GroupVersionKind) {
+	var last *SqlInstanceGroupEvent
+	send := func(e SqlInstanceGroupEvent) bool {
+		if last != nil && last.State == e.State && last.Readiness == e.Readiness &&
+			conditionReason(last) == conditionReason(&e) && conditionMessage(last) == conditionMessage(&e) {
+			return true
+		}
+		e.Time = time.Now()
+		last = &e
+		select {
+		case events <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	fail := func(name string, err error) {
+		e := baseEvent
+		e.State = StateFailed
+		e.Error = &AppError{Name: name, Message: err.Error()}
+		send(e)
+	}
+
+	app, err := s.app.Cluster(baseEvent.Cluster)
+	if err != nil {
+		fail("MonitorResource", err)
+		return
+	}
+	si, ok := s.monitorInformer(ctx, app, baseEvent, gvk, fail)
+	if !ok {
+		return
+	}
+	if _, err := si.lookup(baseEvent.Name); err != nil && !send(notFoundEvent(baseEvent, err)) {
+		return
+	}
+
+	sub := si.subscribe(baseEvent.Name)
+	defer sub.Stop()
+	for {
+		select {
+		case e, ok := <-sub.ResultChan():
+			if !ok {
+				return
+			}
+			event := notFoundEvent(baseEvent, fmt.Errorf("%s %s was deleted", baseEvent.Type, baseEvent.Name))
+			if e.Type != watch.Deleted {
+				event, _ = s.processEvent(baseEvent, e)
+				if event.Readiness == ReadinessFailed {
+					event.State = StateFailed
+				}
+			}
+			if !send(event) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// monitorRetry spaces out the attempts to start watching a resource.
+var monitorRetry = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    math.MaxInt32,
+	Cap:      time.Minute,
+}
+
+// monitorInformer returns the informer of the resource's kind, retrying with
+// a backoff until ctx ends. Each failure is sent as an event, so the resource
+// shows as Failed while it can't be watched.
+func (s *SqlInstanceGroup) monitorInformer(
+	ctx context.Context,
+	app *Application,
+	baseEvent SqlInstanceGroupEvent,
+	gvk schema.GroupVersionKind,
+	fail func(string, error),
+) (*sharedInformer, bool) {
+	backoff := monitorRetry
+	for attempt := 1; ; attempt++ {
+		si, err := app.informers().get(ctx, kindResource(gvk), baseEvent.Namespace)
+		if err == nil {
+			return si, true
+		}
+		if ctx.Err() != nil {
+			return nil, false
+		}
+		fail("MonitorResource", err)
+		delay := backoff.Step()
+		s.app.resourceLogger(baseEvent).Warn("can't watch resource, retrying", "error", err, logKeyAttempt, attempt, "retryIn", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+func notFoundEvent(baseEvent SqlInstanceGroupEvent, err error) SqlInstanceGroupEvent {
+	baseEvent.State = StateFailed
+	baseEvent.Error = &AppError{Name: "NotFound", Message: err.Error()}
+	return baseEvent
+}
+
+func conditionReason(e *SqlInstanceGroupEvent) string {
+	if e.Condition == nil {
+		return ""
+	}
+	return e.Condition.Reason
+}
+
+func conditionMessage(e *SqlInstanceGroupEvent) string {
+	if e.Condition == nil {
+		return ""
+	}
+	return e.Condition.Message
+}
@@ -0,0 +1,58 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestMonitorRetriesWatch(t *testing.T) {
+	retry := monitorRetry
+	monitorRetry.Duration = time.Millisecond
+	defer func() { monitorRetry = retry }()
+
+	gvk := mustLookupKind(SqlResourceInstance)
+	instance := &unstructured.Unstructured{}
+	instance.SetGroupVersionKind(gvk)
+	instance.SetNamespace("default")
+	instance.SetName("uno")
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{kindResource(gvk): "SQLInstanceList"}, instance)
+	var lists atomic.Int32
+	client.PrependReactor("list", "*", func(clienttesting.Action) (bool, runtime.Object, error) {
+		if lists.Add(1) == 1 {
+			return true, nil, apierrors.NewForbidden(kindResource(gvk).GroupResource(), "", nil)
+		}
+		return false, nil, nil
+	})
+	m, err := LoadManifest(strings.NewReader("instances:\n- name: uno\n"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var events []SqlInstanceGroupEvent
+	err = newTestApp("default", nil, nil, client).MonitorCloudSQL(ctx, m, func(e SqlInstanceGroupEvent) {
+		events = append(events, e)
+		if len(events) == 2 {
+			cancel()
+		}
+	})
+	require.NoError(t, err)
+
+	// the resource is Failed until it can be watched, then it is monitored
+	require.Len(t, events, 2)
+	assert.Equal(t, StateFailed, events[0].State)
+	assert.Equal(t, "MonitorResource", events[0].Error.Name)
+	assert.Nil(t, events[1].Error)
+}
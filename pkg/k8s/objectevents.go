@@ -0,0 +1,446 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ObjectEvent is one or more Kubernetes Events about the same object with the
+// same type, reason and message, counted together.
+type ObjectEvent struct {
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Count     int32     `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+func (e *ObjectEvent) String() string {
+	return fmt.Sprintf("%s %s/%s %s (x%d): %s", e.Type, e.Kind, e.Name, e.Reason, e.Count, e.Message)
+}
+
+// involvedKind is the kind Events about a resource of type t refer to, e.g.
+// SQLInstance for SqlInstance.
+func involvedKind(t DependencyType) string {
+	if gvk, ok := LookupKind(t); ok {
+		return gvk.Kind
+	}
+	return string(t)
+}
+
+func eventCount(ev *corev1.Event) int32 {
+	count := ev.Count
+	if ev.Series != nil && ev.Series.Count > count {
+		count = ev.Series.Count
+	}
+	if count == 0 {
+		count = 1
+	}
+	return count
+}
+
+func eventTimes(ev *corev1.Event) (time.Time, time.Time) {
+	first, last := ev.FirstTimestamp.Time, ev.LastTimestamp.Time
+	if first.IsZero() {
+		first = ev.EventTime.Time
+	}
+	if first.IsZero() {
+		first = ev.CreationTimestamp.Time
+	}
+	if ev.Series != nil && !ev.Series.LastObservedTime.IsZero() {
+		last = ev.Series.LastObservedTime.Time
+	}
+	if last.IsZero() {
+		last = first
+	}
+	return first, last
+}
+
+// foldEvents de-duplicates events by object, type, reason and message,
+// adding up their counts. The result is ordered by when each was first seen.
+func foldEvents(events []*corev1.Event) []ObjectEvent {
+	var folded []ObjectEvent
+	index := make(map[string]int)
+	for _, ev := range events {
+		key := strings.Join([]string{ev.InvolvedObject.Kind, ev.InvolvedObject.Name, ev.Type, ev.Reason, ev.Message}, "/")
+		first, last := eventTimes(ev)
+
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(folded)
+			folded = append(folded, ObjectEvent{
+				Kind:      ev.InvolvedObject.Kind,
+				Name:      ev.InvolvedObject.Name,
+				Type:      ev.Type,
+				Reason:    ev.Reason,
+				Message:   ev.Message,
+				Count:     eventCount(ev),
+				FirstSeen: first,
+				LastSeen:  last,
+			})
+			continue
+		}
+		f := &folded[i]
+		f.Count += eventCount(ev)
+		if first.Before(f.FirstSeen) {
+			f.FirstSeen = first
+		}
+		if last.After(f.LastSeen) {
+			f.LastSeen = last
+		}
+	}
+	sort.SliceStable(folded, func(i, j int) bool {
+		return folded[i].FirstSeen.Before(folded[j].FirstSeen)
+	})
+	return folded
+}
+
+// GetObjectEvents returns the events about an object, de-duplicated.
+func (app *Application) GetObjectEvents(ctx context.Context, namespace, kind, name string) ([]ObjectEvent, error) {
+	if namespace == "" {
+		namespace = app.namespace
+	}
+	list, err := app.eventListWatch(ctx, namespace, kind, name).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*corev1.Event
+	for i := range list.(*corev1.EventList).Items {
+		ev := &list.(*corev1.EventList).Items[i]
+		if ev.InvolvedObject.Kind == kind && ev.InvolvedObject.Name == name {
+			events = append(events, ev)
+		}
+	}
+	return foldEvents(events), nil
+}
+
+// WatchObjectEvents streams the events about an object. Each time an event
+// is added or repeated, the de-duplicated entry it belongs to is sent with
+// its new count. The channel is closed when ctx ends or the watch fails.
+func (app *Application) WatchObjectEvents(ctx context.Context, namespace, kind, name string) (<-chan ObjectEvent, error) {
+	if namespace == "" {
+		namespace = app.namespace
+	}
+	watcher, err := newListWatcher(ctx, app.eventListWatch(ctx, namespace, kind, name))
+	if err != nil {
+		return nil, err
+	}
+
+	log := newEventLog()
+	log.track("", namespace, kind, name)
+	out := make(chan ObjectEvent)
+	go func() {
+		defer close(out)
+		defer watcher.Stop()
+		for {
+			select {
+			case e, ok := <-watcher.ResultChan():
+				if !ok || e.Type == watch.Error {
+					return
+				}
+				ev, ok := e.Object.(*corev1.Event)
+				if !ok || e.Type == watch.Deleted || !log.record(ctx, "", ev) {
+					continue
+				}
+				for _, folded := range log.forObject("", namespace, kind, name) {
+					if folded.Reason == ev.Reason && folded.Message == ev.Message && folded.Type == ev.Type {
+						select {
+						case out <- folded:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// eventListWatch lists and watches the events of a namespace. With a kind,
+// and a name, only those about such objects are asked for, but callers still
+// have to filter as not every server, or fake, supports the selector.
+func (app *Application) eventListWatch(ctx context.Context, namespace, kind, name string) *cache.ListWatch {
+	selector := fields.Set{}
+	if kind != "" {
+		selector["involvedObject.kind"] = kind
+	}
+	if name != "" {
+		selector["involvedObject.name"] = name
+	}
+	fieldSelector := selector.AsSelector().String()
+	events := app.kubeClient.CoreV1().Events(namespace)
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return events.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return events.Watch(ctx, options)
+		},
+	}
+}
+
+// eventLog collects the events about tracked objects across clusters and
+// namespaces. Workloads also collect the events of the ReplicaSets and pods
+// they control, going by their ownerReferences.
+type eventLog struct {
+	mu      sync.Mutex
+	tracked map[eventObject]bool
+	// events holds the latest copy of each Event by the object it is about.
+	events map[eventObject]map[string]*corev1.Event
+	// owners maps each ReplicaSet and pod events were seen about to the
+	// workload controlling it, the zero eventObject when there is none.
+	owners map[eventObject]eventObject
+	// controller looks up the workload controlling a ReplicaSet or pod. When
+	// it is nil, only the events of tracked objects are kept.
+	controller func(ctx context.Context, o eventObject) (eventObject, error)
+	// backoff spaces out the retries of a failed event watch.
+	backoff wait.Backoff
+}
+
+type eventObject struct {
+	cluster, namespace, kind, name string
+}
+
+// workloadChild reports whether o is of a kind a workload controls.
+func (o eventObject) workloadChild() bool {
+	return o.kind == "Pod" || o.kind == "ReplicaSet"
+}
+
+func newEventLog() *eventLog {
+	return &eventLog{
+		tracked: make(map[eventObject]bool),
+		events:  make(map[eventObject]map[string]*corev1.Event),
+		owners:  make(map[eventObject]eventObject),
+		backoff: wait.Backoff{
+			Duration: time.Second,
+			Factor:   2,
+			Jitter:   0.1,
+			Steps:    math.MaxInt32,
+			Cap:      30 * time.Second,
+		},
+	}
+}
+
+func (l *eventLog) track(cluster, namespace, kind, name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tracked[eventObject{cluster, namespace, kind, name}] = true
+}
+
+// sources returns the cluster, namespace and kind of every tracked object,
+// and the kinds a tracked workload controls.
+func (l *eventLog) sources() []eventObject {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	seen := make(map[eventObject]bool)
+	var out []eventObject
+	add := func(o eventObject) {
+		if !seen[o] {
+			seen[o] = true
+			out = append(out, o)
+		}
+	}
+	for o := range l.tracked {
+		add(eventObject{cluster: o.cluster, namespace: o.namespace, kind: o.kind})
+		if isWorkloadKind(DependencyType(o.kind)) {
+			add(eventObject{cluster: o.cluster, namespace: o.namespace, kind: "ReplicaSet"})
+			add(eventObject{cluster: o.cluster, namespace: o.namespace, kind: "Pod"})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return fmt.Sprint(out[i]) < fmt.Sprint(out[j])
+	})
+	return out
+}
+
+// record keeps ev if it is about a tracked object, or a ReplicaSet or pod of
+// a tracked workload, and reports whether it did.
+func (l *eventLog) record(ctx context.Context, cluster string, ev *corev1.Event) bool {
+	o := eventObject{cluster, ev.InvolvedObject.Namespace, ev.InvolvedObject.Kind, ev.InvolvedObject.Name}
+	if o.namespace == "" {
+		o.namespace = ev.Namespace
+	}
+
+	owner, ok := l.owner(ctx, o)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.tracked[o] && !(ok && l.tracked[owner]) {
+		return false
+	}
+	if l.events[o] == nil {
+		l.events[o] = make(map[string]*corev1.Event)
+	}
+	l.events[o][ev.Namespace+"/"+ev.Name] = ev
+	return true
+}
+
+// owner returns the workload controlling o, looking it up the first time.
+// Objects that don't exist anymore are taken to have none.
+func (l *eventLog) owner(ctx context.Context, o eventObject) (eventObject, bool) {
+	if !o.workloadChild() || l.controller == nil {
+		return eventObject{}, false
+	}
+	l.mu.Lock()
+	owner, ok := l.owners[o]
+	l.mu.Unlock()
+	if ok {
+		return owner, owner != eventObject{}
+	}
+
+	owner, err := l.controller(ctx, o)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return eventObject{}, false
+	}
+	l.mu.Lock()
+	l.owners[o] = owner
+	l.mu.Unlock()
+	return owner, owner != eventObject{}
+}
+
+// controllerOf returns the workload controlling a ReplicaSet or pod. The
+// pods of a Deployment are controlled by it through their ReplicaSet.
+func (app *Application) controllerOf(ctx context.Context, o eventObject) (eventObject, error) {
+	clusterApp, err := app.Cluster(o.cluster)
+	if err != nil {
+		return eventObject{}, err
+	}
+
+	var ref *metav1.OwnerReference
+	switch o.kind {
+	case "Pod":
+		pod, err := clusterApp.kubeClient.CoreV1().Pods(o.namespace).Get(ctx, o.name, metav1.GetOptions{})
+		if err != nil {
+			return eventObject{}, err
+		}
+		ref = metav1.GetControllerOf(pod)
+	case "ReplicaSet":
+		rs, err := clusterApp.kubeClient.AppsV1().ReplicaSets(o.namespace).Get(ctx, o.name, metav1.GetOptions{})
+		if err != nil {
+			return eventObject{}, err
+		}
+		ref = metav1.GetControllerOf(rs)
+	}
+	if ref == nil {
+		return eventObject{}, nil
+	}
+
+	owner := eventObject{o.cluster, o.namespace, ref.Kind, ref.Name}
+	if owner.workloadChild() {
+		return app.controllerOf(ctx, owner)
+	}
+	return owner, nil
+}
+
+// forObject returns the de-duplicated events about an object, and for a
+// workload those of its ReplicaSets and pods too.
+func (l *eventLog) forObject(cluster, namespace, kind, name string) []ObjectEvent {
+	w := eventObject{cluster, namespace, kind, name}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var events []*corev1.Event
+	for o, byName := range l.events {
+		if o != w && l.owners[o] != w {
+			continue
+		}
+		for _, ev := range byName {
+			events = append(events, ev)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Name < events[j].Name
+	})
+	return foldEvents(events)
+}
+
+// follow records the events of every tracked kind of object until ctx ends.
+// A watch that fails is logged and started again after a backoff.
+func (l *eventLog) follow(ctx context.Context, app *Application) {
+	l.controller = app.controllerOf
+	for _, source := range l.sources() {
+		logger := app.resourceLogger(SqlInstanceGroupEvent{
+			Type:      "Event",
+			Namespace: source.namespace,
+			Cluster:   source.cluster,
+		}).With("involvedKind", source.kind)
+		clusterApp, err := app.Cluster(source.cluster)
+		if err != nil {
+			logger.Warn("can't follow events", "error", err)
+			continue
+		}
+		go l.followKind(ctx, clusterApp, source, logger)
+	}
+}
+
+func (l *eventLog) followKind(ctx context.Context, app *Application, source eventObject, logger *slog.Logger) {
+	backoff := l.backoff
+	for attempt := 1; ; attempt++ {
+		listed, err := l.watchKind(ctx, app, source)
+		if ctx.Err() != nil {
+			return
+		}
+		if listed {
+			backoff = l.backoff
+		}
+		delay := backoff.Step()
+		logger.Warn("event watch failed, retrying", "error", err, logKeyAttempt, attempt, "retryIn", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// watchKind records the events about objects of the source's kind until the
+// watch ends, and returns why it did. listed is set once the events could be
+// listed.
+func (l *eventLog) watchKind(ctx context.Context, app *Application, source eventObject) (listed bool, err error) {
+	watcher, err := newListWatcher(ctx, app.eventListWatch(ctx, source.namespace, source.kind, ""))
+	if err != nil {
+		return false, err
+	}
+	defer watcher.Stop()
+	for {
+		select {
+		case e, ok := <-watcher.ResultChan():
+			if !ok {
+				return true, errors.New("watch closed")
+			}
+			if e.Type == watch.Error {
+				return true, apierrors.FromObject(e.Object)
+			}
+			if ev, ok := e.Object.(*corev1.Event); ok && e.Type != watch.Deleted {
+				l.record(ctx, source.cluster, ev)
+			}
+		case <-ctx.Done():
+			return true, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package k8s
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testEvent(name, kind, object, reason string, count int32, at time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "default"},
+		InvolvedObject: corev1.ObjectReference{Kind: kind, Name: object, Namespace: "default"},
+		Type:           corev1.EventTypeWarning,
+		Reason:         reason,
+		Message:        reason + " happened",
+		Count:          count,
+		FirstTimestamp: metav1.NewTime(at),
+		LastTimestamp:  metav1.NewTime(at),
+	}
+}
+
+func TestFoldEvents(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	folded := foldEvents([]*corev1.Event{
+		testEvent("a", "SQLInstance", "uno", "UpdateFailed", 3, start.Add(time.Minute)),
+		testEvent("b", "SQLInstance", "uno", "Updating", 0, start),
+		testEvent("c", "SQLInstance", "uno", "UpdateFailed", 2, start.Add(2*time.Minute)),
+	})
+
+	require.Len(t, folded, 2)
+	assert.Equal(t, "Updating", folded[0].Reason)
+	assert.Equal(t, int32(1), folded[0].Count)
+	assert.Equal(t, "UpdateFailed", folded[1].Reason)
+	assert.Equal(t, int32(5), folded[1].Count)
+	assert.Equal(t, start.Add(time.Minute), folded[1].FirstSeen)
+	assert.Equal(t, start.Add(2*time.Minute), folded[1].LastSeen)
+}
+
+func TestGetObjectEvents(t *testing.T) {
+	now := time.Now()
+	app, _ := newTestKubeApp(
+		testEvent("a", "SQLInstance", "uno", "UpdateFailed", 1, now),
+		testEvent("b", "SQLInstance", "dos", "UpdateFailed", 1, now),
+		testEvent("c", "SQLDatabase", "uno", "UpdateFailed", 1, now),
+	)
+
+	events, err := app.GetObjectEvents(context.TODO(), "", "SQLInstance", "uno")
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "uno", events[0].Name)
+}
+
+func controlledBy(kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+}
+
+func TestEventLogWorkloadPods(t *testing.T) {
+	app, _ := newTestKubeApp(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name: "web-5d4f8", Namespace: "default", OwnerReferences: controlledBy("Deployment", "web"),
+		}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "web-5d4f8-x2z", Namespace: "default", OwnerReferences: controlledBy("ReplicaSet", "web-5d4f8"),
+		}},
+		// named like a pod of web, but controlled by another workload
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "web-hook-0", Namespace: "default", OwnerReferences: controlledBy("StatefulSet", "web-hook"),
+		}},
+	)
+	log := newEventLog()
+	log.controller = app.controllerOf
+	log.track("", "default", "Deployment", "web")
+
+	ctx := context.TODO()
+	now := time.Now()
+	assert.True(t, log.record(ctx, "", testEvent("a", "Pod", "web-5d4f8-x2z", "BackOff", 1, now)))
+	assert.True(t, log.record(ctx, "", testEvent("b", "ReplicaSet", "web-5d4f8", "FailedCreate", 1, now)))
+	assert.False(t, log.record(ctx, "", testEvent("c", "Pod", "web-hook-0", "BackOff", 1, now)))
+	assert.False(t, log.record(ctx, "", testEvent("d", "Pod", "web-5d4f8-gone", "BackOff", 1, now)))
+
+	assert.Len(t, log.forObject("", "default", "Deployment", "web"), 2)
+	assert.Empty(t, log.forObject("", "default", "StatefulSet", "web-hook"))
+}
+
+func TestEventLogFollowRetries(t *testing.T) {
+	app, kube := newTestKubeApp()
+	var lists atomic.Int32
+	kube.PrependReactor("list", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if lists.Add(1) == 1 {
+			return true, nil, apierrors.NewServiceUnavailable("try again")
+		}
+		assert.Equal(t, "involvedObject.kind=SQLInstance", action.(k8stesting.ListAction).GetListRestrictions().Fields.String())
+		return true, &corev1.EventList{ListMeta: metav1.ListMeta{ResourceVersion: "1"}}, nil
+	})
+	events := watch.NewFake()
+	kube.PrependWatchReactor("events", k8stesting.DefaultWatchReactor(events, nil))
+
+	log := newEventLog()
+	log.backoff.Duration = time.Millisecond
+	log.track("", "default", "SQLInstance", "uno")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log.follow(ctx, app)
+
+	ev := testEvent("a", "SQLInstance", "uno", "UpdateFailed", 1, time.Now())
+	ev.ResourceVersion = "2"
+	events.Add(ev)
+	assert.Equal(t, int32(2), lists.Load())
+	assert.Eventually(t, func() bool {
+		return len(log.forObject("", "default", "SQLInstance", "uno")) == 1
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,50 @@
+package k8s_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chrisbradleydev/go-k8s/pkg/k8s/k8stest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testEvent(name, kind, object, reason string, count int32) *corev1.Event {
+	now := metav1.Now()
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "default"},
+		InvolvedObject: corev1.ObjectReference{Kind: kind, Name: object, Namespace: "default"},
+		Type:           corev1.EventTypeWarning,
+		Reason:         reason,
+		Message:        reason + " happened",
+		Count:          count,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+	}
+}
+
+func TestWatchObjectEvents(t *testing.T) {
+	c := k8stest.NewCluster("default")
+	_, err := c.Kube.CoreV1().Events("default").Create(context.TODO(),
+		testEvent("a", "Deployment", "web", "FailedCreate", 1), metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events, err := c.App().WatchObjectEvents(ctx, "", "Deployment", "web")
+	require.NoError(t, err)
+
+	first := <-events
+	assert.Equal(t, int32(1), first.Count)
+
+	// The same event recorded again by another Event object is counted with
+	// the first.
+	_, err = c.Kube.CoreV1().Events("default").Create(ctx,
+		testEvent("b", "Deployment", "web", "FailedCreate", 2), metav1.CreateOptions{})
+	require.NoError(t, err)
+	second := <-events
+	assert.Equal(t, int32(3), second.Count)
+}
@@ -0,0 +1,341 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	cnrm "github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/client/clientset/versioned"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// inClusterNamespaceFile holds the pod's namespace when running in-cluster.
+const inClusterNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// Option configures an Application created with New.
+type Option func(*appOptions)
+
+type appOptions struct {
+	kubeconfig  string
+	context     string
+	namespace   string
+	restConfig  *rest.Config
+	qps         float32
+	burst       int
+	userAgent   string
+	impersonate rest.ImpersonationConfig
+	timeout     time.Duration
+	logger      *slog.Logger
+	metrics     *Metrics
+	timeouts    Timeouts
+
+	kubeClient kubernetes.Interface
+	cnrmClient cnrm.Interface
+	dynClient  dynamic.Interface
+	clusters   map[string]*Application
+}
+
+// WithKubeconfig reads the given kubeconfig file instead of $KUBECONFIG or
+// ~/.kube/config.
+func WithKubeconfig(path string) Option {
+	return func(o *appOptions) {
+		o.kubeconfig = path
+	}
+}
+
+// WithContext picks a kubeconfig context other than the current one.
+func WithContext(name string) Option {
+	return func(o *appOptions) {
+		o.context = name
+	}
+}
+
+// WithNamespace overrides the namespace of the kubeconfig context or pod.
+func WithNamespace(namespace string) Option {
+	return func(o *appOptions) {
+		o.namespace = namespace
+	}
+}
+
+// WithRESTConfig uses an existing rest config instead of loading one.
+func WithRESTConfig(restConfig *rest.Config) Option {
+	return func(o *appOptions) {
+		o.restConfig = restConfig
+	}
+}
+
+// WithRateLimit sets the client-side QPS and burst.
+func WithRateLimit(qps float32, burst int) Option {
+	return func(o *appOptions) {
+		o.qps = qps
+		o.burst = burst
+	}
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(o *appOptions) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithImpersonation makes every request as another user.
+func WithImpersonation(user string, groups ...string) Option {
+	return func(o *appOptions) {
+		o.impersonate = rest.ImpersonationConfig{UserName: user, Groups: groups}
+	}
+}
+
+// WithTimeout limits each request to the API server. Watches, which are
+// meant to stay open, are not limited.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *appOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithClients uses existing clients, such as fake clientsets, instead of
+// creating them from a rest config.
+func WithClients(kubeClient kubernetes.Interface, cnrmClient cnrm.Interface, dynClient dynamic.Interface) Option {
+	return func(o *appOptions) {
+		o.kubeClient = kubeClient
+		o.cnrmClient = cnrmClient
+		o.dynClient = dynClient
+	}
+}
+
+// WithCluster makes an existing application available as the named cluster,
+// instead of creating one from the kubeconfig context of that name.
+func WithCluster(name string, app *Application) Option {
+	return func(o *appOptions) {
+		if o.clusters == nil {
+			o.clusters = make(map[string]*Application)
+		}
+		o.clusters[name] = app
+	}
+}
+
+// New creates an application. Without options it loads the kubeconfig from
+// $KUBECONFIG or ~/.kube/config and, when there is none, falls back to the
+// in-cluster config so the same binary works as a Kubernetes Job.
+func New(opts ...Option) (*Application, error) {
+	o := &appOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return newApp(o)
+}
+
+func newApp(o *appOptions) (*Application, error) {
+	app := &Application{
+		kubeClient: o.kubeClient,
+		cnrmClient: o.cnrmClient,
+		dynClient:  o.dynClient,
+		namespace:  o.namespace,
+		logger:     o.logger,
+		metrics:    o.metrics,
+		timeouts:   o.timeouts,
+		opts:       o,
+		clusters:   make(map[string]*Application),
+	}
+	for name, cluster := range o.clusters {
+		app.clusters[name] = cluster
+	}
+	if app.kubeClient != nil && app.cnrmClient != nil && app.dynClient != nil {
+		return app, nil
+	}
+
+	restConfig, namespace, err := o.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	app.restConfig = restConfig
+	if app.namespace == "" {
+		app.namespace = namespace
+	}
+
+	if app.kubeClient == nil {
+		if app.kubeClient, err = app.createClient(); err != nil {
+			return nil, err
+		}
+	}
+	if app.cnrmClient == nil {
+		if app.cnrmClient, err = app.createCNRM(); err != nil {
+			return nil, err
+		}
+	}
+	if app.dynClient == nil {
+		if app.dynClient, err = app.createDynamic(); err != nil {
+			return nil, err
+		}
+	}
+	return app, nil
+}
+
+// loadConfig returns the rest config with the options applied and the
+// namespace of the kubeconfig context or pod.
+func (o *appOptions) loadConfig() (*rest.Config, string, error) {
+	restConfig, namespace := o.restConfig, ""
+	if restConfig == nil {
+		var err error
+		restConfig, namespace, err = o.loadKubeconfig()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	restConfig = rest.CopyConfig(restConfig)
+	if o.qps > 0 {
+		restConfig.QPS = o.qps
+	}
+	if o.burst > 0 {
+		restConfig.Burst = o.burst
+	}
+	if o.userAgent != "" {
+		restConfig.UserAgent = o.userAgent
+	}
+	if o.impersonate.UserName != "" {
+		restConfig.Impersonate = o.impersonate
+	}
+	if o.timeout > 0 {
+		// rest.Config.Timeout would end watches too, so the timeout is set
+		// on each request instead.
+		timeout := o.timeout
+		restConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &timeoutRoundTripper{rt: rt, timeout: timeout}
+		})
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+	return restConfig, namespace, nil
+}
+
+// timeoutRoundTripper gives every request but watches and followed logs a
+// deadline, which holds until the response body is closed.
+type timeoutRoundTripper struct {
+	rt      http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *timeoutRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	query := req.URL.Query()
+	if query.Get("watch") == "true" || query.Get("follow") == "true" {
+		return t.rt.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.rt.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func (t *timeoutRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return t.rt
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+func (o *appOptions) loadKubeconfig() (*rest.Config, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if o.kubeconfig != "" {
+		rules.ExplicitPath = o.kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: o.context}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	restConfig, err := clientConfig.ClientConfig()
+	if clientcmd.IsEmptyConfig(err) && o.kubeconfig == "" && o.context == "" {
+		return inClusterConfig()
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, "", err
+	}
+	return restConfig, namespace, nil
+}
+
+func inClusterConfig() (*rest.Config, string, error) {
+	restConfig, err := rest.InClusterConfig()
+	if errors.Is(err, rest.ErrNotInCluster) {
+		return nil, "", errors.New("no kubeconfig found and not running in a cluster")
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("in-cluster config: %w", err)
+	}
+
+	namespace := ""
+	if data, err := os.ReadFile(inClusterNamespaceFile); err == nil {
+		namespace = strings.TrimSpace(string(data))
+	}
+	return restConfig, namespace, nil
+}
+
+// Cluster returns the application for the cluster of the named kubeconfig
+// context, creating it with the same options on first use. The empty name is
+// the application itself.
+func (app *Application) Cluster(name string) (*Application, error) {
+	if name == "" {
+		return app, nil
+	}
+
+	app.clustersMu.Lock()
+	defer app.clustersMu.Unlock()
+	if cluster, ok := app.clusters[name]; ok {
+		return cluster, nil
+	}
+	if app.opts == nil || app.opts.restConfig != nil || app.opts.kubeClient != nil {
+		return nil, fmt.Errorf("cluster %q is not configured", name)
+	}
+
+	o := *app.opts
+	o.context = name
+	o.namespace = ""
+	o.clusters = nil
+	o.logger = app.logger
+	o.metrics = app.metrics
+	cluster, err := newApp(&o)
+	if err != nil {
+		return nil, fmt.Errorf("cluster %q: %w", name, err)
+	}
+	if app.clusters == nil {
+		app.clusters = make(map[string]*Application)
+	}
+	app.clusters[name] = cluster
+	return cluster, nil
+}
+
+// allClusters returns the application and every other cluster it has used.
+func (app *Application) allClusters() []*Application {
+	app.clustersMu.Lock()
+	defer app.clustersMu.Unlock()
+	apps := []*Application{app}
+	for _, cluster := range app.clusters {
+		apps = append(apps, cluster)
+	}
+	return apps
+}
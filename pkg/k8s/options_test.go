@@ -0,0 +1,173 @@
+package k8s
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cnrm "github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/client/clientset/versioned"
+	cnrmfake "github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+const testKubeconfig = `
+apiVersion: v1
+kind: Config
+current-context: uno
+clusters:
+- name: uno
+  cluster:
+    server: https://uno.example.com
+- name: dos
+  cluster:
+    server: https://dos.example.com
+contexts:
+- name: uno
+  context:
+    cluster: uno
+    user: test
+    namespace: uno-ns
+- name: dos
+  context:
+    cluster: dos
+    user: test
+users:
+- name: test
+  user:
+    token: secret
+`
+
+func writeTestKubeconfig(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(path, []byte(testKubeconfig), 0o600))
+	return path
+}
+
+func TestNewKubeconfig(t *testing.T) {
+	t.Setenv("KUBECONFIG", writeTestKubeconfig(t))
+
+	app, err := New()
+	require.NoError(t, err)
+	assert.Equal(t, "https://uno.example.com", app.restConfig.Host)
+	assert.Equal(t, "uno-ns", app.Namespace())
+}
+
+func TestNewContext(t *testing.T) {
+	app, err := New(WithKubeconfig(writeTestKubeconfig(t)), WithContext("dos"))
+	require.NoError(t, err)
+	assert.Equal(t, "https://dos.example.com", app.restConfig.Host)
+	assert.Equal(t, "default", app.Namespace())
+
+	_, err = New(WithKubeconfig(writeTestKubeconfig(t)), WithContext("tres"))
+	assert.Error(t, err)
+}
+
+func TestNewRESTOptions(t *testing.T) {
+	app, err := New(
+		WithKubeconfig(writeTestKubeconfig(t)),
+		WithNamespace("other"),
+		WithRateLimit(50, 100),
+		WithUserAgent("test-agent"),
+		WithImpersonation("jane", "admins"),
+		WithTimeout(time.Minute),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "other", app.Namespace())
+	assert.Equal(t, float32(50), app.restConfig.QPS)
+	assert.Equal(t, 100, app.restConfig.Burst)
+	assert.Equal(t, "test-agent", app.restConfig.UserAgent)
+	assert.Equal(t, "jane", app.restConfig.Impersonate.UserName)
+	assert.Equal(t, []string{"admins"}, app.restConfig.Impersonate.Groups)
+	// the timeout is set on each request, as watches must outlive it
+	assert.Zero(t, app.restConfig.Timeout)
+	assert.NotNil(t, app.restConfig.WrapTransport)
+}
+
+func TestTimeoutRoundTripper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+		_, _ = io.WriteString(w, "{}")
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &timeoutRoundTripper{rt: http.DefaultTransport, timeout: 50 * time.Millisecond}}
+
+	_, err := client.Get(server.URL + "/api/v1/pods")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	resp, err := client.Get(server.URL + "/api/v1/pods?watch=true")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "{}", string(body))
+}
+
+// newTestApp creates an application in namespace on the given clients, or
+// on empty fakes for those that are nil.
+func newTestApp(namespace string, kubeClient kubernetes.Interface, cnrmClient cnrm.Interface, dynClient dynamic.Interface) *Application {
+	if kubeClient == nil {
+		kubeClient = kubefake.NewSimpleClientset()
+	}
+	if cnrmClient == nil {
+		cnrmClient = cnrmfake.NewSimpleClientset()
+	}
+	if dynClient == nil {
+		dynClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	}
+	// with every client given there's no config to load, so New can't fail
+	app, _ := New(WithClients(kubeClient, cnrmClient, dynClient), WithNamespace(namespace))
+	return app
+}
+
+func TestNewWithClients(t *testing.T) {
+	t.Setenv("KUBECONFIG", filepath.Join(t.TempDir(), "missing"))
+
+	app, err := New(
+		WithClients(kubefake.NewSimpleClientset(), cnrmfake.NewSimpleClientset(), dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())),
+		WithNamespace("test"),
+	)
+	require.NoError(t, err)
+	assert.Nil(t, app.restConfig)
+	assert.Equal(t, "test", app.Namespace())
+}
+
+func TestInNamespaceKeepsOptions(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	metrics := NewMetrics()
+	other := newTestApp("default", nil, nil, nil)
+	app, err := New(
+		WithClients(kubefake.NewSimpleClientset(), cnrmfake.NewSimpleClientset(), dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())),
+		WithNamespace("uno"),
+		WithLogger(logger),
+		WithMetrics(metrics),
+		WithWaitTimeouts(Timeouts{Overall: &metav1.Duration{Duration: time.Minute}}),
+		WithCluster("dos", other),
+	)
+	require.NoError(t, err)
+
+	ns := app.inNamespace("tres")
+	assert.Equal(t, "tres", ns.Namespace())
+	assert.Same(t, logger, ns.logger)
+	assert.Same(t, metrics, ns.metrics)
+	assert.Equal(t, time.Minute, ns.timeouts.Overall.Duration)
+	cluster, err := ns.Cluster("dos")
+	require.NoError(t, err)
+	assert.Same(t, other, cluster)
+	assert.Same(t, app, app.inNamespace("uno"))
+}
@@ -0,0 +1,416 @@
+package k8s
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+type OutputFormat string
+
+const (
+	OutputText   OutputFormat = "text"
+	OutputJSON   OutputFormat = "json"
+	OutputNDJSON OutputFormat = "ndjson"
+	OutputJUnit  OutputFormat = "junit"
+	// OutputTUI redraws a tree of every resource in place, and is plain
+	// text when not writing to a terminal.
+	OutputTUI OutputFormat = "tui"
+)
+
+var OutputFormats = []OutputFormat{OutputText, OutputJSON, OutputNDJSON, OutputJUnit, OutputTUI}
+
+// Printer turns the events of a wait, and the report at the end of it, into
+// user facing output.
+type Printer interface {
+	PrintEvent(e SqlInstanceGroupEvent) error
+	PrintReport(r *WaitReport) error
+}
+
+// NewPrinter returns the printer for a format. The options only affect the
+// text and tui formats.
+func NewPrinter(format OutputFormat, w io.Writer, opts ...PrinterOption) (Printer, error) {
+	o := &printerOptions{theme: Themes["default"], color: ColorAuto}
+	for _, opt := range opts {
+		opt(o)
+	}
+	style := NewStyle(w, o.theme, o.color)
+
+	switch format {
+	case OutputText, "":
+		return &textPrinter{w: w, style: style}, nil
+	case OutputJSON:
+		return &jsonPrinter{w: w}, nil
+	case OutputNDJSON:
+		return &ndjsonPrinter{enc: json.NewEncoder(w)}, nil
+	case OutputJUnit:
+		return &junitPrinter{w: w}, nil
+	case OutputTUI:
+		if !isTerminal(w) {
+			return &textPrinter{w: w, style: style}, nil
+		}
+		return newDashboardPrinter(w, style), nil
+	}
+	return nil, fmt.Errorf("unknown output format %q, must be one of %v", format, OutputFormats)
+}
+
+type textPrinter struct {
+	w     io.Writer
+	style Style
+}
+
+func (p *textPrinter) PrintEvent(e SqlInstanceGroupEvent) error {
+	if e.Condition == nil {
+		return nil
+	}
+	if _, err := fmt.Fprintln(p.w, fmtResourceStatus(p.style, e.Type.String(), e.Name, e.State, e.Condition)); err != nil {
+		return err
+	}
+	for _, ev := range e.Events {
+		if ev.Type != corev1.EventTypeWarning {
+			continue
+		}
+		if _, err := fmt.Fprintf(p.w, "  %s\n", p.style.Severity(SeverityProgressing, ev.String())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *textPrinter) PrintReport(r *WaitReport) error {
+	_, err := fmt.Fprint(p.w, r.String())
+	return err
+}
+
+// eventJSON is the NDJSON representation of a SqlInstanceGroupEvent.
+type eventJSON struct {
+	Time      time.Time      `json:"time"`
+	Group     string         `json:"group,omitempty"`
+	Cluster   string         `json:"cluster,omitempty"`
+	Namespace string         `json:"namespace,omitempty"`
+	Type      DependencyType `json:"type"`
+	Name      string         `json:"name"`
+	State     ResourceState  `json:"state,omitempty"`
+	Readiness ReadinessState `json:"readiness,omitempty"`
+	Condition *conditionJSON `json:"condition,omitempty"`
+	Error     *AppError      `json:"error,omitempty"`
+	Events    []ObjectEvent  `json:"events,omitempty"`
+}
+
+type conditionJSON struct {
+	Type               string `json:"type"`
+	Status             string `json:"status"`
+	Reason             string `json:"reason"`
+	Message            string `json:"message,omitempty"`
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
+}
+
+type ndjsonPrinter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (p *ndjsonPrinter) PrintEvent(e SqlInstanceGroupEvent) error {
+	out := eventJSON{
+		Time:      e.Time,
+		Cluster:   e.Cluster,
+		Namespace: e.Namespace,
+		Type:      e.Type,
+		Name:      e.Name,
+		State:     e.State,
+		Readiness: e.Readiness,
+		Error:     e.Error,
+		Events:    e.Events,
+	}
+	if e.Group != nil {
+		out.Group = e.Group.Name
+	}
+	if e.Condition != nil {
+		out.Condition = &conditionJSON{
+			Type:               e.Condition.Type,
+			Status:             string(e.Condition.Status),
+			Reason:             e.Condition.Reason,
+			Message:            e.Condition.Message,
+			LastTransitionTime: e.Condition.LastTransitionTime,
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.enc.Encode(out)
+}
+
+// summaryJSON is the last NDJSON record, written once the wait is over.
+type summaryJSON struct {
+	Time    time.Time         `json:"time"`
+	Summary reportSummaryJSON `json:"summary"`
+}
+
+type reportSummaryJSON struct {
+	DurationSeconds float64 `json:"durationSeconds"`
+	ExitCode        int     `json:"exitCode"`
+	Ready           int     `json:"ready"`
+	Failed          int     `json:"failed"`
+	Skipped         int     `json:"skipped"`
+	TimedOut        int     `json:"timedOut"`
+	Total           int     `json:"total"`
+}
+
+func (p *ndjsonPrinter) PrintReport(r *WaitReport) error {
+	out := summaryJSON{
+		Time: r.Started.Add(r.Duration),
+		Summary: reportSummaryJSON{
+			DurationSeconds: r.Duration.Seconds(),
+			ExitCode:        r.ExitCode(),
+			Ready:           r.count(StateReady),
+			Failed:          r.count(StateFailed),
+			Skipped:         r.count(StateSkipped),
+			TimedOut:        r.count(StateTimedOut) + r.count(StatePending),
+			Total:           len(r.Resources),
+		},
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.enc.Encode(out)
+}
+
+type reportJSON struct {
+	Started         time.Time      `json:"started"`
+	DurationSeconds float64        `json:"durationSeconds"`
+	ExitCode        int            `json:"exitCode"`
+	Clusters        []*clusterJSON `json:"clusters,omitempty"`
+	Resources       []*resultJSON  `json:"resources"`
+}
+
+// clusterJSON summarizes one cluster when the report covers several.
+type clusterJSON struct {
+	Name     string `json:"name"`
+	ExitCode int    `json:"exitCode"`
+	Ready    int    `json:"ready"`
+	Total    int    `json:"total"`
+}
+
+type resultJSON struct {
+	Group           string         `json:"group"`
+	Cluster         string         `json:"cluster,omitempty"`
+	Namespace       string         `json:"namespace,omitempty"`
+	Type            DependencyType `json:"type"`
+	Name            string         `json:"name"`
+	State           ResourceState  `json:"state"`
+	Reason          string         `json:"reason,omitempty"`
+	Message         string         `json:"message,omitempty"`
+	DurationSeconds float64        `json:"durationSeconds"`
+	Error           *AppError      `json:"error,omitempty"`
+	Events          []ObjectEvent  `json:"events,omitempty"`
+}
+
+func (r *WaitReport) MarshalJSON() ([]byte, error) {
+	out := reportJSON{
+		Started:         r.Started,
+		DurationSeconds: r.Duration.Seconds(),
+		ExitCode:        r.ExitCode(),
+		Resources:       make([]*resultJSON, 0, len(r.Resources)),
+	}
+	if clusters := r.Clusters(); len(clusters) > 1 {
+		for _, cluster := range clusters {
+			cr := r.ForCluster(cluster)
+			out.Clusters = append(out.Clusters, &clusterJSON{
+				Name:     cluster,
+				ExitCode: cr.ExitCode(),
+				Ready:    cr.count(StateReady),
+				Total:    len(cr.Resources),
+			})
+		}
+	}
+	for _, result := range r.Resources {
+		out.Resources = append(out.Resources, &resultJSON{
+			Group:           result.Group,
+			Cluster:         result.Cluster,
+			Namespace:       result.Namespace,
+			Type:            result.Type,
+			Name:            result.Name,
+			State:           result.State,
+			Reason:          result.Reason,
+			Message:         result.Message,
+			DurationSeconds: result.Duration.Seconds(),
+			Error:           result.Error,
+			Events:          result.Events,
+		})
+	}
+	return json.Marshal(out)
+}
+
+type jsonPrinter struct {
+	w io.Writer
+}
+
+func (p *jsonPrinter) PrintEvent(_ SqlInstanceGroupEvent) error {
+	return nil
+}
+
+func (p *jsonPrinter) PrintReport(r *WaitReport) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Name     string            `xml:"name,attr"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Skipped  int               `xml:"skipped,attr"`
+	Time     string            `xml:"time,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Skipped   int              `xml:"skipped,attr"`
+	Time      string           `xml:"time,attr"`
+	Timestamp string           `xml:"timestamp,attr"`
+	TestCases []*junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// junitPrinter writes one test suite per group and one test case per
+// resource.
+type junitPrinter struct {
+	w io.Writer
+}
+
+func (p *junitPrinter) PrintEvent(_ SqlInstanceGroupEvent) error {
+	return nil
+}
+
+func (p *junitPrinter) PrintReport(r *WaitReport) error {
+	out := &junitTestSuites{
+		Name: "cloudsql",
+		Time: junitSeconds(r.Duration),
+	}
+
+	suites := make(map[string]*junitTestSuite)
+	for _, result := range r.Resources {
+		name := junitSuiteName(result)
+		suite, ok := suites[name]
+		if !ok {
+			suite = &junitTestSuite{
+				Name:      name,
+				Time:      junitSeconds(r.Duration),
+				Timestamp: r.Started.UTC().Format(time.RFC3339),
+			}
+			suites[name] = suite
+			out.Suites = append(out.Suites, suite)
+		}
+
+		tc := &junitTestCase{
+			Name:      result.Name,
+			ClassName: result.Type.String(),
+			Time:      junitSeconds(result.Duration),
+		}
+		switch result.State {
+		case StateReady:
+		case StateSkipped:
+			tc.Skipped = &junitSkipped{Message: junitMessage(result)}
+			suite.Skipped++
+			out.Skipped++
+		default:
+			tc.Failure = &junitFailure{
+				Type:    string(result.State),
+				Message: junitMessage(result),
+				Text:    junitDetail(result),
+			}
+			suite.Failures++
+			out.Failures++
+		}
+		suite.Tests++
+		out.Tests++
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	if _, err := io.WriteString(p.w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(p.w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(p.w, "\n")
+	return err
+}
+
+// junitSuiteName names the suite of a resource after its group, or after the
+// resource itself when it isn't in one, like a workload.
+func junitSuiteName(result *ResourceResult) string {
+	name := result.Group
+	namespace := result.groupNamespace()
+	if name == "" {
+		name = result.Type.String() + "/" + result.Name
+		namespace = result.Namespace
+	}
+	if namespace != "" {
+		name = namespace + "/" + name
+	}
+	if result.Cluster != "" {
+		name = result.Cluster + "/" + name
+	}
+	return name
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func junitMessage(result *ResourceResult) string {
+	if result.Error != nil {
+		return result.Error.Message
+	}
+	if result.Reason != "" {
+		return string(result.State) + ": " + result.Reason
+	}
+	return string(result.State)
+}
+
+func junitDetail(result *ResourceResult) string {
+	var lines []string
+	if result.Reason != "" {
+		lines = append(lines, "reason: "+result.Reason)
+	}
+	if result.Message != "" {
+		lines = append(lines, "message: "+result.Message)
+	}
+	if result.Error != nil {
+		lines = append(lines, "error: "+result.Error.Error())
+	}
+	for _, ev := range result.Events {
+		lines = append(lines, "event: "+ev.String())
+	}
+	return strings.Join(lines, "\n")
+}
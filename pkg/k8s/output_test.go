@@ -0,0 +1,100 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNDJSONPrinter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	p, err := NewPrinter(OutputNDJSON, buf)
+	assert.NoError(t, err)
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, reason := range []string{"Updating", "UpToDate"} {
+		assert.NoError(t, p.PrintEvent(SqlInstanceGroupEvent{
+			Type:      SqlResourceUser,
+			Name:      sqlUsers[0].Name,
+			Condition: &v1alpha1.Condition{Type: "Ready", Status: "True", Reason: reason},
+			Time:      ts,
+		}))
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+
+	var e map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &e))
+	assert.Equal(t, "SqlUser", e["type"])
+	assert.Equal(t, "2024-01-02T03:04:05Z", e["time"])
+	assert.Equal(t, "UpToDate", e["condition"].(map[string]interface{})["reason"])
+}
+
+func TestNDJSONPrinterSummary(t *testing.T) {
+	report, _ := newTestReport()
+	report.record(SqlInstanceGroupEvent{
+		Type:  SqlResourceInstance,
+		Name:  sqlInstances[0].Name,
+		State: StateFailed,
+	})
+	report.finish(context.TODO())
+
+	buf := &bytes.Buffer{}
+	p, err := NewPrinter(OutputNDJSON, buf)
+	assert.NoError(t, err)
+	assert.NoError(t, p.PrintReport(report))
+
+	var summary struct {
+		Summary map[string]interface{} `json:"summary"`
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &summary))
+	assert.Equal(t, float64(ExitFailed), summary.Summary["exitCode"])
+	assert.Equal(t, float64(1), summary.Summary["failed"])
+	assert.Equal(t, float64(2), summary.Summary["skipped"])
+	assert.Equal(t, float64(3), summary.Summary["total"])
+}
+
+func TestJUnitPrinter(t *testing.T) {
+	report, _ := newTestReport()
+	report.record(SqlInstanceGroupEvent{
+		Type:  SqlResourceInstance,
+		Name:  sqlInstances[0].Name,
+		State: StateFailed,
+		Error: &AppError{Name: "CheckInstance", Message: "not found"},
+	})
+	report.finish(context.TODO())
+
+	buf := &bytes.Buffer{}
+	p, err := NewPrinter(OutputJUnit, buf)
+	assert.NoError(t, err)
+	assert.NoError(t, p.PrintReport(report))
+
+	out := buf.String()
+	assert.Contains(t, out, `<testsuites name="cloudsql" tests="3" failures="1" skipped="2"`)
+	assert.Contains(t, out, `<failure message="not found" type="Failed">`)
+	assert.Contains(t, out, `<skipped message="not waited on, SqlInstance `+sqlInstances[0].Name+` failed">`)
+}
+
+func TestJUnitPrinterWorkloadSuite(t *testing.T) {
+	sig := NewSqlInstanceGroupList(context.TODO(), NewApp("default"))
+	sig.AddWorkload(Workload{Kind: WorkloadDeployment, Name: "web"})
+	report := newWaitReport(sig)
+	report.record(SqlInstanceGroupEvent{Type: WorkloadDeployment, Namespace: "default", Name: "web", State: StateReady})
+	report.finish(context.TODO())
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, (&junitPrinter{w: buf}).PrintReport(report))
+	assert.Contains(t, buf.String(), `<testsuite name="default/Deployment/web" tests="1" failures="0" skipped="0"`)
+}
+
+func TestUnknownOutputFormat(t *testing.T) {
+	_, err := NewPrinter("yaml", &bytes.Buffer{})
+	assert.Error(t, err)
+}
@@ -7,12 +7,12 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func (app *Application) GetPod(podName string, getOptions metav1.GetOptions) (*corev1.Pod, error) {
+func (app *Application) GetPod(ctx context.Context, podName string, getOptions metav1.GetOptions) (*corev1.Pod, error) {
 	pod, err := app.kubeClient.
 		CoreV1().
 		Pods(app.namespace).
 		Get(
-			context.TODO(),
+			ctx,
 			podName,
 			getOptions,
 		)
@@ -22,12 +22,12 @@ func (app *Application) GetPod(podName string, getOptions metav1.GetOptions) (*c
 	return pod, nil
 }
 
-func (app *Application) GetPods() (*corev1.PodList, error) {
+func (app *Application) GetPods(ctx context.Context) (*corev1.PodList, error) {
 	pods, err := app.kubeClient.
 		CoreV1().
 		Pods(app.namespace).
 		List(
-			context.TODO(),
+			ctx,
 			metav1.ListOptions{},
 		)
 	if err != nil {
@@ -0,0 +1,121 @@
+package k8s
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
+	sqlv1beta1 "github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/sql/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Config Connector condition reasons.
+const (
+	ReasonUpToDate           = "UpToDate"
+	ReasonUpdating           = "Updating"
+	ReasonUpdateFailed       = "UpdateFailed"
+	ReasonDeleting           = "Deleting"
+	ReasonDeleteFailed       = "DeleteFailed"
+	ReasonDependencyNotReady = "DependencyNotReady"
+	ReasonDependencyNotFound = "DependencyNotFound"
+	ReasonDependencyInvalid  = "DependencyInvalid"
+	ReasonManagementConflict = "ManagementConflict"
+)
+
+const conditionTypeReady = "Ready"
+
+type ReadinessState string
+
+const (
+	ReadinessReady              ReadinessState = "Ready"
+	ReadinessProgressing        ReadinessState = "Progressing"
+	ReadinessFailed             ReadinessState = "Failed"
+	ReadinessDependencyNotReady ReadinessState = "DependencyNotReady"
+)
+
+var failedReasons = map[string]bool{
+	ReasonUpdateFailed:       true,
+	ReasonDeleteFailed:       true,
+	ReasonDependencyInvalid:  true,
+	ReasonManagementConflict: true,
+}
+
+var dependencyReasons = map[string]bool{
+	ReasonDependencyNotReady: true,
+	ReasonDependencyNotFound: true,
+}
+
+// Readiness is the result of evaluating a resource's Ready condition.
+type Readiness struct {
+	State ReadinessState
+	// Condition is the Ready condition, or nil if there isn't one yet.
+	Condition *v1alpha1.Condition
+	// Stale is set when the controller hasn't observed the latest
+	// generation, so the condition describes an older spec.
+	Stale bool
+}
+
+// EvaluateReadiness looks up the Ready condition by type and only reports a
+// resource as ready when the condition is True for the current generation.
+// observedGeneration may be nil for controllers that don't set it.
+func EvaluateReadiness(generation int64, observedGeneration *int64, conditions []v1alpha1.Condition) Readiness {
+	var ready *v1alpha1.Condition
+	for i := range conditions {
+		if conditions[i].Type == conditionTypeReady {
+			ready = &conditions[i]
+			break
+		}
+	}
+
+	r := Readiness{State: ReadinessProgressing, Condition: ready}
+	if observedGeneration != nil && *observedGeneration < generation {
+		r.Stale = true
+		return r
+	}
+	if ready == nil {
+		return r
+	}
+
+	switch {
+	case ready.Status == corev1.ConditionTrue:
+		r.State = ReadinessReady
+	case failedReasons[ready.Reason]:
+		r.State = ReadinessFailed
+	case dependencyReasons[ready.Reason]:
+		r.State = ReadinessDependencyNotReady
+	}
+	return r
+}
+
+// ObjectReadiness evaluates the typed SQL kinds and any unstructured Config
+// Connector resource.
+func ObjectReadiness(obj runtime.Object) (Readiness, error) {
+	switch obj := obj.(type) {
+	case *sqlv1beta1.SQLInstance:
+		return EvaluateReadiness(obj.Generation, intToInt64(obj.Status.ObservedGeneration), obj.Status.Conditions), nil
+	case *sqlv1beta1.SQLDatabase:
+		return EvaluateReadiness(obj.Generation, intToInt64(obj.Status.ObservedGeneration), obj.Status.Conditions), nil
+	case *sqlv1beta1.SQLUser:
+		return EvaluateReadiness(obj.Generation, intToInt64(obj.Status.ObservedGeneration), obj.Status.Conditions), nil
+	case *unstructured.Unstructured:
+		conditions, err := unstructuredConditions(obj)
+		if err != nil {
+			return Readiness{State: ReadinessProgressing}, err
+		}
+		var observedGeneration *int64
+		if g, found, err := unstructured.NestedInt64(obj.Object, "status", "observedGeneration"); err == nil && found {
+			observedGeneration = &g
+		}
+		return EvaluateReadiness(obj.GetGeneration(), observedGeneration, conditions), nil
+	}
+	return Readiness{State: ReadinessProgressing}, fmt.Errorf("unexpected object %T", obj)
+}
+
+func intToInt64(i *int) *int64 {
+	if i == nil {
+		return nil
+	}
+	i64 := int64(*i)
+	return &i64
+}
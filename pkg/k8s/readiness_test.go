@@ -0,0 +1,47 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestEvaluateReadiness(t *testing.T) {
+	gen := func(g int64) *int64 { return &g }
+	ready := func(status, reason string) []v1alpha1.Condition {
+		return []v1alpha1.Condition{{Type: "Ready", Status: corev1.ConditionStatus(status), Reason: reason}}
+	}
+
+	tests := []struct {
+		name               string
+		generation         int64
+		observedGeneration *int64
+		conditions         []v1alpha1.Condition
+		want               ReadinessState
+		stale              bool
+	}{
+		{"no conditions", 1, nil, nil, ReadinessProgressing, false},
+		{"up to date", 2, gen(2), ready("True", ReasonUpToDate), ReadinessReady, false},
+		{"no observed generation", 2, nil, ready("True", ReasonUpToDate), ReadinessReady, false},
+		{"stale up to date", 3, gen(2), ready("True", ReasonUpToDate), ReadinessProgressing, true},
+		{"updating", 1, gen(1), ready("False", ReasonUpdating), ReadinessProgressing, false},
+		{"update failed", 1, gen(1), ready("False", ReasonUpdateFailed), ReadinessFailed, false},
+		{"dependency invalid", 1, gen(1), ready("False", ReasonDependencyInvalid), ReadinessFailed, false},
+		{"dependency not ready", 1, gen(1), ready("False", ReasonDependencyNotReady), ReadinessDependencyNotReady, false},
+		{"up to date reason but not true", 1, gen(1), ready("False", ReasonUpToDate), ReadinessProgressing, false},
+		{
+			"ready condition not first", 1, gen(1),
+			[]v1alpha1.Condition{{Type: "Other", Status: "False", Reason: ReasonUpdateFailed}, ready("True", ReasonUpToDate)[0]},
+			ReadinessReady, false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := EvaluateReadiness(tt.generation, tt.observedGeneration, tt.conditions)
+			assert.Equal(t, tt.want, r.State)
+			assert.Equal(t, tt.stale, r.Stale)
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Exit codes returned by WaitReport.ExitCode. Pipelines can gate on these.
+const (
+	ExitReady       = 0 // every resource became ready
+	ExitFailed      = 1 // at least one resource failed or was skipped
+	ExitConfigError = 2 // bad flags, manifest or kubeconfig; nothing was waited on
+	ExitTimeout     = 3 // nothing failed, but some resources weren't ready in time
+)
+
+type ResourceState string
+
+const (
+	StatePending  ResourceState = "Pending"
+	StateReady    ResourceState = "Ready"
+	StateFailed   ResourceState = "Failed"
+	StateTimedOut ResourceState = "TimedOut"
+	// StateSkipped is used for databases and users whose instance failed, so
+	// they were never watched.
+	StateSkipped ResourceState = "Skipped"
+)
+
+// ResourceResult is the final outcome of waiting on a single resource.
+type ResourceResult struct {
+	Group string
+	// Cluster is the kubeconfig context of the resource's cluster, or empty
+	// for the current one.
+	Cluster   string
+	Namespace string
+	Type      DependencyType
+	Name      string
+	State     ResourceState
+	Reason    string
+	Message   string
+	Duration  time.Duration
+	Error     *AppError
+	// Events are the Kubernetes Events about the resource by the end of the
+	// wait, de-duplicated with counts.
+	Events []ObjectEvent
+
+	// group is the group the resource was waited on in, nil for workloads.
+	// Group names are only unique within a namespace and cluster.
+	group *SqlInstanceGroup
+}
+
+// groupNamespace returns the namespace of the instance of the resource's
+// group, or empty when it isn't in one.
+func (r *ResourceResult) groupNamespace() string {
+	if r.group == nil || r.group.standalone {
+		return ""
+	}
+	return r.group.namespaceFor("")
+}
+
+// WaitReport summarizes a WaitForCloudSQL run.
+type WaitReport struct {
+	Started   time.Time
+	Duration  time.Duration
+	Resources []*ResourceResult
+
+	mu    sync.Mutex
+	index map[string]*ResourceResult
+}
+
+func newWaitReport(groups *SqlInstanceGroupList) *WaitReport {
+	r := &WaitReport{
+		Started: time.Now(),
+		index:   make(map[string]*ResourceResult),
+	}
+	for _, group := range groups.Groups {
+		r.add(group.baseEvent(SqlResourceInstance, group.Name, "", ""))
+		for _, db := range group.Databases {
+			r.add(group.baseEvent(SqlResourceDatabase, db.Name, db.Namespace, ""))
+		}
+		for _, user := range group.Users {
+			r.add(group.baseEvent(SqlResourceUser, user.Name, user.Namespace, ""))
+		}
+		for _, resource := range group.Resources {
+			r.add(group.baseEvent(resource.Kind, resource.Name, resource.Namespace, resource.Cluster))
+		}
+	}
+	for _, resource := range groups.Standalone.Resources {
+		r.add(groups.Standalone.baseEvent(resource.Kind, resource.Name, resource.Namespace, resource.Cluster))
+	}
+	for _, workload := range groups.Workloads {
+		r.add(groups.workloadEvent(workload))
+	}
+	return r
+}
+
+func reportKey(e SqlInstanceGroupEvent) string {
+	return e.Cluster + "/" + e.Namespace + "/" + string(e.Type) + "/" + e.Name
+}
+
+// add registers the resource described by a base event.
+func (r *WaitReport) add(e SqlInstanceGroupEvent) {
+	group := ""
+	if e.Group != nil {
+		group = e.Group.Name
+	}
+	result := &ResourceResult{
+		Group:     group,
+		Cluster:   e.Cluster,
+		Namespace: e.Namespace,
+		Type:      e.Type,
+		Name:      e.Name,
+		State:     StatePending,
+		group:     e.Group,
+	}
+	r.Resources = append(r.Resources, result)
+	r.index[reportKey(e)] = result
+}
+
+// record updates the result for the resource an event is about. Results that
+// already reached a final state are left alone.
+func (r *WaitReport) record(e SqlInstanceGroupEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result, ok := r.index[reportKey(e)]
+	if !ok || result.State != StatePending {
+		return
+	}
+	if e.Condition != nil {
+		result.Reason = e.Condition.Reason
+		result.Message = e.Condition.Message
+	}
+	if e.Error != nil {
+		result.Error = e.Error
+	}
+	if e.State != "" && e.State != StatePending {
+		result.State = e.State
+		result.Duration = time.Since(r.Started)
+	}
+
+	// Children of an instance that failed are skipped. When the instance ran
+	// out of time they did too, which mustn't turn a timeout into a failure.
+	// Either way they point at the instance that held them up.
+	if e.Type == SqlResourceInstance && (result.State == StateFailed || result.State == StateTimedOut) {
+		childState, blocked := StateSkipped, &AppError{
+			Name:    "Skipped",
+			Message: fmt.Sprintf("not waited on, %s %s failed", SqlResourceInstance, result.Name),
+		}
+		if result.State == StateTimedOut {
+			childState, blocked = StateTimedOut, &AppError{
+				Name:    "Timeout",
+				Message: fmt.Sprintf("not waited on, %s %s timed out first", SqlResourceInstance, result.Name),
+			}
+		}
+		for _, other := range r.Resources {
+			if other.group == result.group && other.Type != SqlResourceInstance && other.State == StatePending {
+				other.State = childState
+				other.Duration = result.Duration
+				if other.Error == nil {
+					other.Error = blocked
+				}
+			}
+		}
+	}
+}
+
+// finish marks anything still pending once the wait is over. ctx is the
+// context the wait ran under.
+func (r *WaitReport) finish(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Duration = time.Since(r.Started)
+	for _, result := range r.Resources {
+		if result.State != StatePending {
+			continue
+		}
+		result.Duration = r.Duration
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			result.State = StateTimedOut
+			var berr *budgetError
+			if result.Error == nil && errors.As(context.Cause(ctx), &berr) {
+				result.Error = &AppError{Name: "Timeout", Message: berr.Error()}
+			}
+		} else {
+			result.State = StateFailed
+		}
+	}
+}
+
+// addEvents attaches the events collected during the wait to each result.
+func (r *WaitReport) addEvents(log *eventLog) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, result := range r.Resources {
+		result.Events = log.forObject(result.Cluster, result.Namespace, involvedKind(result.Type), result.Name)
+	}
+}
+
+// trackEvents has log collect the events about every resource in the
+// report.
+func (r *WaitReport) trackEvents(log *eventLog) {
+	for _, result := range r.Resources {
+		log.track(result.Cluster, result.Namespace, involvedKind(result.Type), result.Name)
+	}
+}
+
+func (r *WaitReport) count(state ResourceState) int {
+	n := 0
+	for _, result := range r.Resources {
+		if result.State == state {
+			n++
+		}
+	}
+	return n
+}
+
+// ExitCode maps the report to the documented exit codes. Failures win over
+// timeouts because they won't fix themselves on a retry.
+func (r *WaitReport) ExitCode() int {
+	switch {
+	case r.count(StateFailed)+r.count(StateSkipped) > 0:
+		return ExitFailed
+	case r.count(StateTimedOut)+r.count(StatePending) > 0:
+		return ExitTimeout
+	}
+	return ExitReady
+}
+
+// Err returns nil when every resource is ready.
+func (r *WaitReport) Err() error {
+	if r.ExitCode() == ExitReady {
+		return nil
+	}
+	return fmt.Errorf("%d of %d resources ready: %d failed, %d skipped, %d timed out",
+		r.count(StateReady),
+		len(r.Resources),
+		r.count(StateFailed),
+		r.count(StateSkipped),
+		r.count(StateTimedOut)+r.count(StatePending))
+}
+
+// Clusters returns every cluster in the report in order of appearance. The
+// current cluster is the empty string.
+func (r *WaitReport) Clusters() []string {
+	var clusters []string
+	seen := make(map[string]bool)
+	for _, result := range r.Resources {
+		if !seen[result.Cluster] {
+			seen[result.Cluster] = true
+			clusters = append(clusters, result.Cluster)
+		}
+	}
+	return clusters
+}
+
+// ForCluster returns the part of the report about one cluster, so that it can
+// be checked on its own, e.g. to tell a primary from a DR cluster.
+func (r *WaitReport) ForCluster(cluster string) *WaitReport {
+	out := &WaitReport{Started: r.Started, Duration: r.Duration}
+	for _, result := range r.Resources {
+		if result.Cluster == cluster {
+			out.Resources = append(out.Resources, result)
+		}
+	}
+	return out
+}
+
+func clusterName(cluster string) string {
+	if cluster == "" {
+		return "(current)"
+	}
+	return cluster
+}
+
+func (r *WaitReport) String() string {
+	clusters := r.Clusters()
+	multiCluster := len(clusters) > 1
+
+	str := strings.Builder{}
+	w := tabwriter.NewWriter(&str, 0, 0, 3, ' ', 0)
+	if multiCluster {
+		fmt.Fprint(w, "CLUSTER\t")
+	}
+	fmt.Fprintln(w, "NAMESPACE\tGROUP\tTYPE\tNAME\tSTATE\tREASON\tDURATION\tERROR")
+	for _, result := range r.Resources {
+		errMsg := ""
+		if result.Error != nil {
+			errMsg = result.Error.Message
+		}
+		if multiCluster {
+			fmt.Fprintf(w, "%s\t", clusterName(result.Cluster))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			result.Namespace,
+			result.Group,
+			result.Type,
+			result.Name,
+			result.State,
+			result.Reason,
+			result.Duration.Round(time.Second),
+			errMsg)
+	}
+	w.Flush()
+
+	warnings := false
+	for _, result := range r.Resources {
+		for _, ev := range result.Events {
+			if ev.Type != corev1.EventTypeWarning {
+				continue
+			}
+			if !warnings {
+				str.WriteString("\nWarnings:\n")
+				warnings = true
+			}
+			fmt.Fprintf(&str, "  %s\n", ev.String())
+		}
+	}
+
+	if multiCluster {
+		str.WriteRune('\n')
+		for _, cluster := range clusters {
+			summary := "ready"
+			if err := r.ForCluster(cluster).Err(); err != nil {
+				summary = err.Error()
+			}
+			fmt.Fprintf(&str, "%s: %s\n", clusterName(cluster), summary)
+		}
+	}
+	return str.String()
+}
@@ -0,0 +1,127 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestReport() (*WaitReport, *SqlInstanceGroupList) {
+	sig := NewSqlInstanceGroupList(context.TODO(), NewApp(""))
+	group := sig.NewGroup(sqlInstances[0].Name)
+	sig.AddGroup(group)
+	group.AddDatabase(sqlDatabases[0])
+	group.AddUser(sqlUsers[0])
+	return newWaitReport(sig), sig
+}
+
+func TestReportReady(t *testing.T) {
+	report, _ := newTestReport()
+	for _, result := range report.Resources {
+		report.record(SqlInstanceGroupEvent{
+			Type:      result.Type,
+			Name:      result.Name,
+			Condition: &v1alpha1.Condition{Reason: "UpToDate"},
+			State:     StateReady,
+		})
+	}
+	report.finish(context.TODO())
+
+	assert.Equal(t, ExitReady, report.ExitCode())
+	assert.NoError(t, report.Err())
+}
+
+func TestReportInstanceFailureSkipsChildren(t *testing.T) {
+	report, _ := newTestReport()
+	report.record(SqlInstanceGroupEvent{
+		Type:  SqlResourceInstance,
+		Name:  sqlInstances[0].Name,
+		State: StateFailed,
+		Error: &AppError{Name: "CheckInstance", Message: "not found"},
+	})
+	report.finish(context.TODO())
+
+	assert.Equal(t, ExitFailed, report.ExitCode())
+	assert.Equal(t, StateSkipped, report.Resources[1].State)
+	assert.Equal(t, StateSkipped, report.Resources[2].State)
+}
+
+func TestReportInstanceTimeoutTimesOutChildren(t *testing.T) {
+	report, _ := newTestReport()
+	report.record(SqlInstanceGroupEvent{
+		Type:  SqlResourceInstance,
+		Name:  sqlInstances[0].Name,
+		State: StateTimedOut,
+	})
+	report.finish(context.TODO())
+
+	assert.Equal(t, ExitTimeout, report.ExitCode())
+	for _, result := range report.Resources[1:] {
+		assert.Equal(t, StateTimedOut, result.State)
+		assert.Equal(t, report.Resources[0].Duration, result.Duration)
+	}
+}
+
+func TestReportGroupsMatchedByNamespace(t *testing.T) {
+	m, err := LoadManifest(strings.NewReader(`
+instances:
+- name: uno
+  namespace: a
+- name: uno
+  namespace: b
+databases:
+- name: uno-db
+  instanceName: uno
+  namespace: a
+- name: uno-db
+  instanceName: uno
+  namespace: b
+`))
+	require.NoError(t, err)
+	sig := NewSqlInstanceGroupList(context.TODO(), newTestApp("default", nil, nil, nil))
+	require.NoError(t, sig.InitGroupsFromManifest(m))
+	report := newWaitReport(sig)
+
+	report.record(SqlInstanceGroupEvent{Type: SqlResourceInstance, Namespace: "a", Name: "uno", State: StateFailed})
+	report.record(SqlInstanceGroupEvent{Type: SqlResourceInstance, Namespace: "b", Name: "uno", State: StateReady})
+	report.record(SqlInstanceGroupEvent{Type: SqlResourceDatabase, Namespace: "b", Name: "uno-db", State: StateReady})
+	report.finish(context.TODO())
+
+	states := make(map[string]ResourceState)
+	for _, result := range report.Resources {
+		states[result.Namespace+"/"+result.Name] = result.State
+	}
+	assert.Equal(t, map[string]ResourceState{
+		"a/uno":    StateFailed,
+		"a/uno-db": StateSkipped,
+		"b/uno":    StateReady,
+		"b/uno-db": StateReady,
+	}, states)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, (&junitPrinter{w: buf}).PrintReport(report))
+	assert.Contains(t, buf.String(), `<testsuite name="a/uno" tests="2" failures="1" skipped="1"`)
+	assert.Contains(t, buf.String(), `<testsuite name="b/uno" tests="2" failures="0" skipped="0"`)
+}
+
+func TestReportTimeout(t *testing.T) {
+	report, _ := newTestReport()
+	report.record(SqlInstanceGroupEvent{
+		Type:  SqlResourceInstance,
+		Name:  sqlInstances[0].Name,
+		State: StateReady,
+	})
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 0)
+	defer cancel()
+	<-ctx.Done()
+	report.finish(ctx)
+
+	assert.Equal(t, ExitTimeout, report.ExitCode())
+	assert.Equal(t, StateTimedOut, report.Resources[1].State)
+}
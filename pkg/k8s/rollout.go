@@ -0,0 +1,451 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// revisionAnnotation is set by the deployment controller on a Deployment
+	// and on the ReplicaSet of each of its revisions.
+	revisionAnnotation = "deployment.kubernetes.io/revision"
+	// reasonProgressDeadlineExceeded is the Progressing condition reason once
+	// a rollout has made no progress for spec.progressDeadlineSeconds.
+	reasonProgressDeadlineExceeded = "ProgressDeadlineExceeded"
+	// holdupLookupTimeout bounds looking up what holds a rollout up once the
+	// wait on it has run out of time.
+	holdupLookupTimeout = 10 * time.Second
+	// holdupLogContainers caps the containers whose logs are read for a
+	// rollout that is held up.
+	holdupLogContainers = 5
+)
+
+// RolloutStatus describes how far a Deployment, StatefulSet or DaemonSet
+// rollout has got, the same way kubectl rollout status does.
+type RolloutStatus struct {
+	Name    string
+	Done    bool
+	Message string
+	// Failed is set when the rollout exceeded its progress deadline.
+	Failed bool
+
+	Replicas  int32
+	Updated   int32
+	Available int32
+	// Old is the number of replicas of previous revisions still running.
+	Old int32
+}
+
+// EvaluateRollout reports whether the controller has observed the latest
+// spec and every replica has been updated and is available.
+func EvaluateRollout(d *appsv1.Deployment) RolloutStatus {
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	s := RolloutStatus{
+		Name:      d.Name,
+		Replicas:  replicas,
+		Updated:   d.Status.UpdatedReplicas,
+		Available: d.Status.AvailableReplicas,
+		Old:       d.Status.Replicas - d.Status.UpdatedReplicas,
+	}
+
+	if d.Generation > d.Status.ObservedGeneration {
+		s.Message = fmt.Sprintf("waiting for deployment %q spec update to be observed", d.Name)
+		return s
+	}
+	for _, c := range d.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Reason == reasonProgressDeadlineExceeded {
+			s.Failed = true
+			s.Message = fmt.Sprintf("deployment %q exceeded its progress deadline", d.Name)
+			return s
+		}
+	}
+
+	switch {
+	case s.Updated < s.Replicas:
+		s.Message = fmt.Sprintf("waiting for deployment %q rollout to finish: %d out of %d new replicas have been updated",
+			d.Name, s.Updated, s.Replicas)
+	case s.Old > 0:
+		s.Message = fmt.Sprintf("waiting for deployment %q rollout to finish: %d old replicas are pending termination",
+			d.Name, s.Old)
+	case s.Available < s.Updated:
+		s.Message = fmt.Sprintf("waiting for deployment %q rollout to finish: %d of %d updated replicas are available",
+			d.Name, s.Available, s.Updated)
+	default:
+		s.Done = true
+		s.Message = fmt.Sprintf("deployment %q successfully rolled out", d.Name)
+	}
+	return s
+}
+
+// EvaluateStatefulSetRollout reports whether every replica is ready at the
+// update revision, or up to the partition of a partitioned rolling update.
+// StatefulSets that update OnDelete are done as soon as the spec is observed.
+func EvaluateStatefulSetRollout(sts *appsv1.StatefulSet) RolloutStatus {
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	s := RolloutStatus{
+		Name:      sts.Name,
+		Replicas:  replicas,
+		Updated:   sts.Status.UpdatedReplicas,
+		Available: sts.Status.AvailableReplicas,
+		Old:       sts.Status.Replicas - sts.Status.UpdatedReplicas,
+	}
+
+	if sts.Generation > sts.Status.ObservedGeneration {
+		s.Message = fmt.Sprintf("waiting for statefulset %q spec update to be observed", sts.Name)
+		return s
+	}
+	if sts.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		s.Done = true
+		s.Message = fmt.Sprintf("statefulset %q updates on delete, so there is no rollout to wait for", sts.Name)
+		return s
+	}
+
+	var partition int32
+	if ru := sts.Spec.UpdateStrategy.RollingUpdate; ru != nil && ru.Partition != nil {
+		partition = *ru.Partition
+	}
+	switch {
+	case sts.Status.ReadyReplicas < replicas:
+		s.Message = fmt.Sprintf("waiting for statefulset %q rollout to finish: %d of %d pods are ready",
+			sts.Name, sts.Status.ReadyReplicas, replicas)
+	case partition > 0 && s.Updated < replicas-partition:
+		s.Message = fmt.Sprintf("waiting for statefulset %q partitioned rollout to finish: %d out of %d new pods have been updated",
+			sts.Name, s.Updated, replicas-partition)
+	case partition == 0 && sts.Status.UpdateRevision != sts.Status.CurrentRevision:
+		s.Message = fmt.Sprintf("waiting for statefulset %q rollout to finish: %d pods at revision %s",
+			sts.Name, s.Updated, sts.Status.UpdateRevision)
+	default:
+		s.Done = true
+		s.Message = fmt.Sprintf("statefulset %q successfully rolled out", sts.Name)
+	}
+	return s
+}
+
+// EvaluateDaemonSetRollout reports whether every scheduled pod has been
+// updated and is available. DaemonSets that update OnDelete are done as soon
+// as the spec is observed.
+func EvaluateDaemonSetRollout(ds *appsv1.DaemonSet) RolloutStatus {
+	s := RolloutStatus{
+		Name:      ds.Name,
+		Replicas:  ds.Status.DesiredNumberScheduled,
+		Updated:   ds.Status.UpdatedNumberScheduled,
+		Available: ds.Status.NumberAvailable,
+		Old:       ds.Status.CurrentNumberScheduled - ds.Status.UpdatedNumberScheduled,
+	}
+
+	if ds.Generation > ds.Status.ObservedGeneration {
+		s.Message = fmt.Sprintf("waiting for daemon set %q spec update to be observed", ds.Name)
+		return s
+	}
+	if ds.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType {
+		s.Done = true
+		s.Message = fmt.Sprintf("daemon set %q updates on delete, so there is no rollout to wait for", ds.Name)
+		return s
+	}
+
+	switch {
+	case s.Updated < s.Replicas:
+		s.Message = fmt.Sprintf("waiting for daemon set %q rollout to finish: %d out of %d new pods have been updated",
+			ds.Name, s.Updated, s.Replicas)
+	case s.Available < s.Replicas:
+		s.Message = fmt.Sprintf("waiting for daemon set %q rollout to finish: %d of %d updated pods are available",
+			ds.Name, s.Available, s.Replicas)
+	default:
+		s.Done = true
+		s.Message = fmt.Sprintf("daemon set %q successfully rolled out", ds.Name)
+	}
+	return s
+}
+
+// RolloutError is returned when a rollout fails or doesn't finish in time.
+// It names the ReplicaSet of the new revision and the pods that aren't ready.
+type RolloutError struct {
+	Status     RolloutStatus
+	ReplicaSet string
+	Pods       []PodHoldup
+	Err        error
+}
+
+// PodHoldup is a pod of the new revision that isn't ready, and why. Logs
+// holds the last lines of its failing containers.
+type PodHoldup struct {
+	Name   string
+	Reason string
+	Logs   []string
+}
+
+func (e *RolloutError) Error() string {
+	str := strings.Builder{}
+	str.WriteString(e.Status.Message)
+	if e.Err != nil {
+		str.WriteString(": ")
+		str.WriteString(e.Err.Error())
+	}
+	if e.ReplicaSet != "" {
+		fmt.Fprintf(&str, "; replicaset %s", e.ReplicaSet)
+	}
+	for _, pod := range e.Pods {
+		fmt.Fprintf(&str, "; pod %s: %s", pod.Name, pod.Reason)
+	}
+	return str.String()
+}
+
+func (e *RolloutError) Unwrap() error {
+	return e.Err
+}
+
+// Logs returns the recent logs of the pods holding the rollout up, one
+// indented block per pod, or "" when there are none.
+func (e *RolloutError) Logs() string {
+	str := strings.Builder{}
+	for _, pod := range e.Pods {
+		if len(pod.Logs) == 0 {
+			continue
+		}
+		fmt.Fprintf(&str, "last log lines of pod %s:\n", pod.Name)
+		for _, line := range pod.Logs {
+			fmt.Fprintf(&str, "  %s\n", line)
+		}
+	}
+	return str.String()
+}
+
+// WaitForDeploymentRollout follows a Deployment until its rollout is done.
+// It fails once the rollout exceeds its progress deadline, or when ctx ends
+// first, with a RolloutError saying what is holding the rollout up.
+func (app *Application) WaitForDeploymentRollout(ctx context.Context, name string) (*RolloutStatus, error) {
+	logger := app.log().With(logKeyKind, "Deployment", logKeyName, name, logKeyNamespace, app.namespace)
+	started := time.Now()
+	return app.waitForDeploymentRollout(ctx, app.namespace, name, func(status RolloutStatus) {
+		logger.Info(status.Message, logKeyElapsed, time.Since(started).Round(time.Millisecond))
+	})
+}
+
+func (app *Application) waitForDeploymentRollout(
+	ctx context.Context,
+	namespace, name string,
+	progress func(RolloutStatus),
+) (*RolloutStatus, error) {
+	lw := app.deploymentListWatch(ctx, namespace, name)
+	status, last, err := waitForRollout(ctx, lw, appsv1.Resource("deployments"), "deployment", name, func(obj runtime.Object) (RolloutStatus, bool) {
+		d, ok := obj.(*appsv1.Deployment)
+		if !ok {
+			return RolloutStatus{}, false
+		}
+		return EvaluateRollout(d), true
+	}, progress)
+	if last == nil {
+		return nil, err
+	}
+
+	d := last.(*appsv1.Deployment)
+	switch {
+	case status.Failed:
+		return &status, app.rolloutError(ctx, d, status, nil)
+	case err != nil:
+		// ctx is done, so the holdups are looked up under a deadline of
+		// their own.
+		lookupCtx, cancel := context.WithTimeout(context.Background(), holdupLookupTimeout)
+		defer cancel()
+		return &status, app.rolloutError(lookupCtx, d, status, err)
+	}
+	return &status, nil
+}
+
+// waitForRollout follows the object called name until evaluate says its
+// rollout is done or has failed, or ctx ends. progress is called whenever the
+// status message changes. It returns the last status and object seen, and an
+// error only when the watch itself fails or ctx ends. An object that doesn't
+// exist is a NotFound error of resource straight away, with no object seen.
+func waitForRollout(
+	ctx context.Context,
+	lw cache.ListerWatcher,
+	resource schema.GroupResource,
+	kind, name string,
+	evaluate func(runtime.Object) (RolloutStatus, bool),
+	progress func(RolloutStatus),
+) (RolloutStatus, runtime.Object, error) {
+	var status RolloutStatus
+	watcher, err := newListWatcher(ctx, mustList(lw, resource, name))
+	if err != nil {
+		return status, nil, err
+	}
+	defer watcher.Stop()
+
+	var last runtime.Object
+	for {
+		select {
+		case e, ok := <-watcher.ResultChan():
+			if !ok {
+				return status, last, fmt.Errorf("%s %q: watch closed", kind, name)
+			}
+			switch e.Type {
+			case watch.Error:
+				return status, last, fmt.Errorf("%s %q: %v", kind, name, e.Object)
+			case watch.Deleted:
+				return status, last, fmt.Errorf("%s %q was deleted during the rollout", kind, name)
+			}
+			if m, err := meta.Accessor(e.Object); err != nil || m.GetName() != name {
+				continue
+			}
+			next, ok := evaluate(e.Object)
+			if !ok {
+				continue
+			}
+
+			last = e.Object
+			if next.Message != status.Message {
+				progress(next)
+			}
+			status = next
+			if status.Done || status.Failed {
+				return status, last, nil
+			}
+		case <-ctx.Done():
+			return status, last, fmt.Errorf("%s %q: %w", kind, name, context.Cause(ctx))
+		}
+	}
+}
+
+// mustList wraps lw so that its first list fails with NotFound when it
+// doesn't hold the object called name. Otherwise a missing object would only
+// be noticed once ctx ends, as nothing is ever sent about it. Later lists
+// are passed through, as the object going away then is a deletion.
+func mustList(lw cache.ListerWatcher, resource schema.GroupResource, name string) cache.ListerWatcher {
+	var listed bool
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			list, err := lw.List(options)
+			if err != nil || listed {
+				return list, err
+			}
+			listed = true
+			items, err := meta.ExtractList(list)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				if m, err := meta.Accessor(item); err == nil && m.GetName() == name {
+					return list, nil
+				}
+			}
+			return nil, apierrors.NewNotFound(resource, name)
+		},
+		WatchFunc: lw.Watch,
+	}
+}
+
+// rolloutError finds the ReplicaSet of the deployment's current revision and
+// its pods that aren't ready.
+func (app *Application) rolloutError(ctx context.Context, d *appsv1.Deployment, status RolloutStatus, cause error) error {
+	rerr := &RolloutError{Status: status, Err: cause}
+
+	rs, err := app.newReplicaSet(ctx, d)
+	if err != nil || rs == nil {
+		return rerr
+	}
+	rerr.ReplicaSet = rs.Name
+
+	rerr.Pods = app.podHoldups(ctx, d.Namespace, rs.Spec.Selector, rs)
+	return rerr
+}
+
+// podHoldups diagnoses the pods of owner that aren't ready and reads the
+// recent logs of their first few failing containers.
+func (app *Application) podHoldups(ctx context.Context, namespace string, selector *metav1.LabelSelector, owner metav1.Object) []PodHoldup {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil
+	}
+	pods, err := app.kubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: sel.String()})
+	if err != nil {
+		return nil
+	}
+
+	var holdups []PodHoldup
+	logged := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !metav1.IsControlledBy(pod, owner) {
+			continue
+		}
+		d := DiagnosePod(pod)
+		if d.Ready {
+			continue
+		}
+		logged += app.attachLogs(ctx, &d, DefaultLogLines, holdupLogContainers-logged)
+
+		holdup := PodHoldup{Name: pod.Name, Reason: d.Message}
+		for _, cd := range d.Containers {
+			for _, line := range cd.Logs {
+				holdup.Logs = append(holdup.Logs, cd.Name+": "+line)
+			}
+		}
+		holdups = append(holdups, holdup)
+	}
+	return holdups
+}
+
+// newReplicaSet returns the ReplicaSet of the deployment's current revision.
+func (app *Application) newReplicaSet(ctx context.Context, d *appsv1.Deployment) (*appsv1.ReplicaSet, error) {
+	selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	list, err := app.kubeClient.AppsV1().ReplicaSets(d.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	revision := d.Annotations[revisionAnnotation]
+	for i := range list.Items {
+		rs := &list.Items[i]
+		if metav1.IsControlledBy(rs, d) && rs.Annotations[revisionAnnotation] == revision {
+			return rs, nil
+		}
+	}
+	return nil, nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// deploymentListWatch lists and watches a single Deployment by name.
+func (app *Application) deploymentListWatch(ctx context.Context, namespace, name string) *cache.ListWatch {
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", name).String()
+	deployments := app.kubeClient.AppsV1().Deployments(namespace)
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return deployments.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return deployments.Watch(ctx, options)
+		},
+	}
+}
@@ -0,0 +1,158 @@
+package k8s_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chrisbradleydev/go-k8s/pkg/k8s"
+	"github.com/chrisbradleydev/go-k8s/pkg/k8s/k8stest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	revisionAnnotation             = "deployment.kubernetes.io/revision"
+	reasonProgressDeadlineExceeded = "ProgressDeadlineExceeded"
+)
+
+func newTestDeployment(replicas int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			Namespace:   "default",
+			UID:         types.UID("web-uid"),
+			Generation:  2,
+			Annotations: map[string]string{revisionAnnotation: "2"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		},
+		Status: appsv1.DeploymentStatus{ObservedGeneration: 2},
+	}
+}
+
+func TestEvaluateRollout(t *testing.T) {
+	d := newTestDeployment(3)
+	d.Status.ObservedGeneration = 1
+	assert.Contains(t, k8s.EvaluateRollout(d).Message, "spec update to be observed")
+
+	d = newTestDeployment(3)
+	d.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1}
+	assert.Contains(t, k8s.EvaluateRollout(d).Message, "1 out of 3 new replicas have been updated")
+
+	d.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 3}
+	assert.Contains(t, k8s.EvaluateRollout(d).Message, "1 old replicas are pending termination")
+
+	d.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 2}
+	assert.Contains(t, k8s.EvaluateRollout(d).Message, "2 of 3 updated replicas are available")
+
+	d.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3}
+	assert.True(t, k8s.EvaluateRollout(d).Done)
+
+	d.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Reason: reasonProgressDeadlineExceeded}}
+	assert.True(t, k8s.EvaluateRollout(d).Failed)
+}
+
+// newTestRolloutCluster returns a fake cluster holding the given
+// Deployments, ReplicaSets and Pods.
+func newTestRolloutCluster(t *testing.T, objects ...runtime.Object) *k8stest.Cluster {
+	t.Helper()
+	c := k8stest.NewCluster("default")
+	for _, obj := range objects {
+		var err error
+		switch obj := obj.(type) {
+		case *appsv1.Deployment:
+			_, err = c.Kube.AppsV1().Deployments(obj.Namespace).Create(context.TODO(), obj, metav1.CreateOptions{})
+		case *appsv1.ReplicaSet:
+			_, err = c.Kube.AppsV1().ReplicaSets(obj.Namespace).Create(context.TODO(), obj, metav1.CreateOptions{})
+		case *corev1.Pod:
+			_, err = c.Kube.CoreV1().Pods(obj.Namespace).Create(context.TODO(), obj, metav1.CreateOptions{})
+		default:
+			t.Fatalf("unexpected %T", obj)
+		}
+		require.NoError(t, err)
+	}
+	return c
+}
+
+func TestWaitForDeploymentRollout(t *testing.T) {
+	d := newTestDeployment(2)
+	d.Status.Replicas = 2
+	d.Status.UpdatedReplicas = 1
+	c := newTestRolloutCluster(t, d)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		done := d.DeepCopy()
+		done.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}
+		_, _ = c.Kube.AppsV1().Deployments("default").UpdateStatus(context.TODO(), done, metav1.UpdateOptions{})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	status, err := c.App().WaitForDeploymentRollout(ctx, "web")
+	require.NoError(t, err)
+	assert.True(t, status.Done)
+}
+
+func TestWaitForDeploymentRolloutNotFound(t *testing.T) {
+	c := newTestRolloutCluster(t, newTestDeployment(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	status, err := c.App().WaitForDeploymentRollout(ctx, "wbe")
+	assert.True(t, apierrors.IsNotFound(err), err)
+	assert.EqualError(t, err, `deployments.apps "wbe" not found`)
+	assert.Nil(t, status)
+	assert.NoError(t, ctx.Err(), "the wait should fail straight away")
+}
+
+func TestWaitForDeploymentRolloutDeadlineExceeded(t *testing.T) {
+	d := newTestDeployment(1)
+	d.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Reason: reasonProgressDeadlineExceeded}}
+
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-abc",
+			Namespace:       "default",
+			UID:             types.UID("rs-uid"),
+			Labels:          map[string]string{"app": "web"},
+			Annotations:     map[string]string{revisionAnnotation: "2"},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(d, appsv1.SchemeGroupVersion.WithKind("Deployment"))},
+		},
+		Spec: appsv1.ReplicaSetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-abc-1",
+			Namespace:       "default",
+			Labels:          map[string]string{"app": "web"},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(rs, appsv1.SchemeGroupVersion.WithKind("ReplicaSet"))},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodPending,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "web",
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+			}},
+		},
+	}
+	c := newTestRolloutCluster(t, d, rs, pod)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := c.App().WaitForDeploymentRollout(ctx, "web")
+
+	var rerr *k8s.RolloutError
+	require.ErrorAs(t, err, &rerr)
+	assert.Equal(t, "web-abc", rerr.ReplicaSet)
+	assert.Equal(t, []k8s.PodHoldup{{Name: "web-abc-1", Reason: "container web is ImagePullBackOff"}}, rerr.Pods)
+}
@@ -0,0 +1,205 @@
+package k8s
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Severity is how good or bad a state or reason is, which decides its
+// color.
+type Severity int
+
+const (
+	SeverityNone Severity = iota
+	SeverityReady
+	SeverityProgressing
+	SeverityFailed
+)
+
+// workloadReasonSeverity grades the reasons of the conditions workload
+// events carry.
+var workloadReasonSeverity = map[string]Severity{
+	reasonRolledOut:                SeverityReady,
+	reasonRolloutFailed:            SeverityFailed,
+	reasonRestartFailed:            SeverityFailed,
+	reasonProgressDeadlineExceeded: SeverityFailed,
+}
+
+// ReasonSeverity grades a Config Connector or workload condition reason:
+// UpToDate and RolledOut are ready, the failed reasons are failed and
+// anything else is progressing.
+func ReasonSeverity(reason string) Severity {
+	switch {
+	case reason == "":
+		return SeverityNone
+	case reason == ReasonUpToDate:
+		return SeverityReady
+	case failedReasons[reason]:
+		return SeverityFailed
+	}
+	if severity, ok := workloadReasonSeverity[reason]; ok {
+		return severity
+	}
+	return SeverityProgressing
+}
+
+// StateSeverity grades the state a wait left a resource in.
+func StateSeverity(state ResourceState) Severity {
+	switch state {
+	case StateReady:
+		return SeverityReady
+	case StatePending, StateSkipped:
+		return SeverityProgressing
+	case StateFailed, StateTimedOut:
+		return SeverityFailed
+	}
+	return SeverityNone
+}
+
+// Theme holds the ANSI escape codes each part of the output is drawn in.
+// Empty codes leave that part plain.
+type Theme struct {
+	Kind        string
+	Name        string
+	Ready       string
+	Progressing string
+	Failed      string
+}
+
+// Themes are the built-in themes by name.
+var Themes = map[string]Theme{
+	"default": {
+		Kind:        ColorBlue,
+		Name:        ColorWhite,
+		Ready:       ColorGreen,
+		Progressing: ColorYellow,
+		Failed:      ColorRed,
+	},
+	// bright suits dark terminals where the default colors are dim.
+	"bright": {
+		Kind:        "\033[1;94m",
+		Name:        "\033[1;97m",
+		Ready:       "\033[1;92m",
+		Progressing: "\033[1;93m",
+		Failed:      "\033[1;91m",
+	},
+	// severity only colors what needs attention.
+	"severity": {
+		Progressing: ColorYellow,
+		Failed:      ColorRed,
+	},
+}
+
+// ThemeNames returns the names of the built-in themes, sorted.
+func ThemeNames() []string {
+	names := make([]string, 0, len(Themes))
+	for name := range Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupTheme returns the built-in theme of the given name.
+func LookupTheme(name string) (Theme, error) {
+	theme, ok := Themes[name]
+	if !ok {
+		return Theme{}, fmt.Errorf("unknown theme %q, must be one of %v", name, ThemeNames())
+	}
+	return theme, nil
+}
+
+// ColorMode says when output is colored.
+type ColorMode string
+
+const (
+	// ColorAuto colors output written to a terminal, unless NO_COLOR is set,
+	// and any output when FORCE_COLOR is.
+	ColorAuto   ColorMode = "auto"
+	ColorAlways ColorMode = "always"
+	ColorNever  ColorMode = "never"
+)
+
+// colorEnabled decides whether output to w is colored. NO_COLOR and
+// FORCE_COLOR follow https://no-color.org and https://force-color.org: set
+// and not empty, NO_COLOR wins over FORCE_COLOR, and both over detection.
+func colorEnabled(mode ColorMode, w io.Writer) bool {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if force := os.Getenv("FORCE_COLOR"); force != "" && force != "0" && force != "false" {
+		return true
+	}
+	return os.Getenv("TERM") != "dumb" && isTerminal(w)
+}
+
+// Style draws parts of the output in the colors of a theme, or plain when
+// color is off.
+type Style struct {
+	theme Theme
+	color bool
+}
+
+// NewStyle returns the style for output to w with the given theme and
+// color mode.
+func NewStyle(w io.Writer, theme Theme, mode ColorMode) Style {
+	return Style{theme: theme, color: colorEnabled(mode, w)}
+}
+
+func (s Style) paint(code, text string) string {
+	if !s.color || code == "" {
+		return text
+	}
+	return code + text + ColorNc
+}
+
+func (s Style) Kind(text string) string {
+	return s.paint(s.theme.Kind, text)
+}
+
+func (s Style) Name(text string) string {
+	return s.paint(s.theme.Name, text)
+}
+
+// Severity draws text in the color of its severity.
+func (s Style) Severity(severity Severity, text string) string {
+	switch severity {
+	case SeverityReady:
+		return s.paint(s.theme.Ready, text)
+	case SeverityProgressing:
+		return s.paint(s.theme.Progressing, text)
+	case SeverityFailed:
+		return s.paint(s.theme.Failed, text)
+	}
+	return text
+}
+
+// PrinterOption changes how a Printer made by NewPrinter draws its output.
+type PrinterOption func(*printerOptions)
+
+type printerOptions struct {
+	theme Theme
+	color ColorMode
+}
+
+// WithTheme draws text output in the colors of theme.
+func WithTheme(theme Theme) PrinterOption {
+	return func(o *printerOptions) {
+		o.theme = theme
+	}
+}
+
+// WithColor says when text output is colored, ColorAuto by default.
+func WithColor(mode ColorMode) PrinterOption {
+	return func(o *printerOptions) {
+		o.color = mode
+	}
+}
@@ -0,0 +1,83 @@
+package k8s
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColorEnabled(t *testing.T) {
+	var buf bytes.Buffer
+	tests := []struct {
+		name     string
+		mode     ColorMode
+		noColor  string
+		force    string
+		expected bool
+	}{
+		{name: "not a terminal", mode: ColorAuto},
+		{name: "forced", mode: ColorAuto, force: "1", expected: true},
+		{name: "forced off", mode: ColorAuto, force: "0"},
+		{name: "NO_COLOR wins", mode: ColorAuto, noColor: "1", force: "1"},
+		{name: "always", mode: ColorAlways, noColor: "1", expected: true},
+		{name: "never", mode: ColorNever, force: "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			t.Setenv("FORCE_COLOR", tt.force)
+			assert.Equal(t, tt.expected, colorEnabled(tt.mode, &buf))
+		})
+	}
+}
+
+func TestReasonSeverity(t *testing.T) {
+	assert.Equal(t, SeverityReady, ReasonSeverity(ReasonUpToDate))
+	assert.Equal(t, SeverityProgressing, ReasonSeverity(ReasonUpdating))
+	assert.Equal(t, SeverityProgressing, ReasonSeverity(ReasonDependencyNotReady))
+	assert.Equal(t, SeverityFailed, ReasonSeverity(ReasonUpdateFailed))
+	assert.Equal(t, SeverityNone, ReasonSeverity(""))
+	assert.Equal(t, SeverityReady, ReasonSeverity("RolledOut"))
+	assert.Equal(t, SeverityFailed, ReasonSeverity("RolloutFailed"))
+	assert.Equal(t, SeverityFailed, ReasonSeverity("RestartFailed"))
+	assert.Equal(t, SeverityFailed, ReasonSeverity("ProgressDeadlineExceeded"))
+	assert.Equal(t, SeverityProgressing, ReasonSeverity("Progressing"))
+}
+
+func TestStateSeverity(t *testing.T) {
+	assert.Equal(t, SeverityReady, StateSeverity(StateReady))
+	assert.Equal(t, SeverityProgressing, StateSeverity(StatePending))
+	assert.Equal(t, SeverityProgressing, StateSeverity(StateSkipped))
+	assert.Equal(t, SeverityFailed, StateSeverity(StateFailed))
+	assert.Equal(t, SeverityFailed, StateSeverity(StateTimedOut))
+}
+
+func TestFmtResourceStatus(t *testing.T) {
+	ready := &v1alpha1.Condition{Reason: ReasonUpToDate}
+	failed := &v1alpha1.Condition{Reason: ReasonUpdateFailed}
+
+	plain := Style{theme: Themes["default"]}
+	assert.Equal(t, "[SqlInstance] uno UpToDate", fmtResourceStatus(plain, "SqlInstance", "uno", StateReady, ready))
+
+	colored := Style{theme: Themes["default"], color: true}
+	assert.Equal(t, "[\033[1;34mSqlInstance\x1b[0m] \033[0;37muno\x1b[0m \033[0;32mUpToDate\x1b[0m",
+		fmtResourceStatus(colored, "SqlInstance", "uno", StateReady, ready))
+	assert.Contains(t, fmtResourceStatus(colored, "SqlInstance", "uno", StatePending, failed), ColorRed+ReasonUpdateFailed)
+	// once the wait is over the state decides: a resource that timed out
+	// still updating is failed, not progressing
+	updating := &v1alpha1.Condition{Reason: ReasonUpdating}
+	assert.Contains(t, fmtResourceStatus(colored, "SqlInstance", "uno", StatePending, updating), ColorYellow+ReasonUpdating)
+	assert.Contains(t, fmtResourceStatus(colored, "SqlInstance", "uno", StateTimedOut, updating), ColorRed+ReasonUpdating)
+	assert.Contains(t, fmtResourceStatus(colored, "Deployment", "web", StatePending, &v1alpha1.Condition{Reason: "RolloutFailed"}), ColorRed+"RolloutFailed")
+
+	severity, err := LookupTheme("severity")
+	require.NoError(t, err)
+	colored.theme = severity
+	assert.Equal(t, "[SqlInstance] uno UpToDate", fmtResourceStatus(colored, "SqlInstance", "uno", StateReady, ready))
+
+	_, err = LookupTheme("neon")
+	assert.EqualError(t, err, `unknown theme "neon", must be one of [bright default severity]`)
+}
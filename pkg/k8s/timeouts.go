@@ -0,0 +1,126 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultWaitTimeout is how long WaitForCloudSQL waits when neither the
+// manifest nor WithWaitTimeouts sets an overall deadline.
+const DefaultWaitTimeout = 20 * time.Minute
+
+// Timeouts bound how long WaitForCloudSQL waits, overall and on each
+// resource of a kind. How long a whole group may take is set on its
+// instance.
+type Timeouts struct {
+	// Overall is the deadline of the whole wait, DefaultWaitTimeout when
+	// unset.
+	Overall *metav1.Duration `yaml:"overall,omitempty" json:"overall,omitempty"`
+	// Kinds is how long a resource of each kind may take to become ready,
+	// counted from when the wait on it starts. Kinds that aren't listed are
+	// only bound by their group and the overall deadline.
+	Kinds map[DependencyType]metav1.Duration `yaml:"kinds,omitempty" json:"kinds,omitempty"`
+}
+
+// merge returns t with the timeouts set in o taking precedence.
+func (t Timeouts) merge(o Timeouts) Timeouts {
+	out := Timeouts{Overall: t.Overall}
+	if o.Overall != nil {
+		out.Overall = o.Overall
+	}
+	if len(t.Kinds)+len(o.Kinds) > 0 {
+		out.Kinds = make(map[DependencyType]metav1.Duration, len(t.Kinds)+len(o.Kinds))
+		for kind, d := range t.Kinds {
+			out.Kinds[kind] = d
+		}
+		for kind, d := range o.Kinds {
+			out.Kinds[kind] = d
+		}
+	}
+	return out
+}
+
+// waitTimeouts returns the timeouts of a wait on the manifest: those set with
+// WithWaitTimeouts, and the manifest's where they are unset.
+func (app *Application) waitTimeouts(m *SqlManifest) Timeouts {
+	if m == nil || m.Timeouts == nil {
+		return app.timeouts
+	}
+	return m.Timeouts.merge(app.timeouts)
+}
+
+func (t Timeouts) overall() time.Duration {
+	if t.Overall == nil {
+		return DefaultWaitTimeout
+	}
+	return t.Overall.Duration
+}
+
+// kind returns the budget of a resource of the kind, or zero when it has
+// none of its own.
+func (t Timeouts) kind(kind DependencyType) time.Duration {
+	return t.Kinds[kind].Duration
+}
+
+func (t Timeouts) validate() []error {
+	var errs []error
+	if t.Overall != nil && t.Overall.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("timeouts.overall: must be positive, got %s", t.Overall.Duration))
+	}
+	for kind, d := range t.Kinds {
+		if d.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("timeouts.kinds.%s: must be positive, got %s", kind, d.Duration))
+		}
+	}
+	return errs
+}
+
+// WithWaitTimeouts sets the timeouts of WaitForCloudSQL. Those that are set
+// take precedence over the manifest's.
+func WithWaitTimeouts(t Timeouts) Option {
+	return func(o *appOptions) {
+		o.timeouts = t
+	}
+}
+
+// SetWaitTimeouts is WithWaitTimeouts for applications that weren't created
+// with it.
+func (app *Application) SetWaitTimeouts(t Timeouts) {
+	app.timeouts = t
+}
+
+// budgetError is the cancellation cause of a context that ran out of a
+// timeout budget, so that the report can say which one it was.
+type budgetError struct {
+	// Scope is what the budget covers: "overall", a group as "group NAME",
+	// or a kind.
+	Scope  string
+	Budget time.Duration
+}
+
+func (e *budgetError) Error() string {
+	return fmt.Sprintf("%s timeout of %s used up", e.Scope, e.Budget)
+}
+
+// withBudget returns a context that ends with a budgetError after budget,
+// or ctx itself when budget is zero.
+func withBudget(ctx context.Context, scope string, budget time.Duration) (context.Context, context.CancelFunc) {
+	if budget <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, budget, &budgetError{Scope: scope, Budget: budget})
+}
+
+// timeoutError says why a wait under ctx ran out of time: the budget that
+// was used up when there is one.
+func timeoutError(ctx context.Context) error {
+	var berr *budgetError
+	if errors.As(context.Cause(ctx), &berr) {
+		return berr
+	}
+	return errors.New("resource watch timed out on context")
+}
@@ -0,0 +1,513 @@
+package k8s_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chrisbradleydev/go-k8s/pkg/k8s"
+	"github.com/chrisbradleydev/go-k8s/pkg/k8s/k8stest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const waitManifest = `
+instances:
+- name: uno
+  failureGracePeriod: 200ms
+databases:
+- name: uno-db
+  instanceName: uno
+users:
+- name: uno-user
+  instanceName: uno
+`
+
+func newTestCluster(t *testing.T) (*k8stest.Cluster, *k8s.SqlManifest) {
+	t.Helper()
+	c := k8stest.NewCluster("default")
+	require.NoError(t, c.AddInstance("uno"))
+	require.NoError(t, c.AddDatabase("uno-db", "uno"))
+	require.NoError(t, c.AddUser("uno-user", "uno"))
+
+	m, err := k8s.LoadManifest(strings.NewReader(waitManifest))
+	require.NoError(t, err)
+	return c, m
+}
+
+func wait(t *testing.T, c *k8stest.Cluster, m *k8s.SqlManifest, timeout time.Duration, steps ...k8stest.Step) *k8s.WaitReport {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	errs := c.Start(ctx, steps...)
+
+	printer, err := k8s.NewPrinter(k8s.OutputText, io.Discard)
+	require.NoError(t, err)
+	app := c.App()
+	app.SetPrinter(printer)
+	report, err := app.WaitForCloudSQL(ctx, m)
+	require.NoError(t, err)
+
+	cancel()
+	if err := <-errs; err != nil && err != context.Canceled {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func result(report *k8s.WaitReport, name string) *k8s.ResourceResult {
+	for _, r := range report.Resources {
+		if r.Name == name {
+			return r
+		}
+	}
+	return &k8s.ResourceResult{}
+}
+
+func resultState(report *k8s.WaitReport, name string) k8s.ResourceState {
+	return result(report, name).State
+}
+
+func TestWaitReady(t *testing.T) {
+	c, m := newTestCluster(t)
+	steps := []k8stest.Step{
+		{Kind: k8s.SqlResourceInstance, Name: "uno", Reason: k8s.ReasonUpToDate},
+		{Kind: k8s.SqlResourceDatabase, Name: "uno-db", Reason: k8s.ReasonUpToDate},
+		{Kind: k8s.SqlResourceUser, Name: "uno-user", Reason: k8s.ReasonUpToDate},
+	}
+
+	report := wait(t, c, m, 10*time.Second, steps...)
+	assert.Equal(t, k8s.ExitReady, report.ExitCode(), report.String())
+}
+
+func TestWaitRecoversFromUpdateFailed(t *testing.T) {
+	c, m := newTestCluster(t)
+	// UpdateFailed only lasts 50ms, well within the grace period.
+	steps := k8stest.Transition(k8s.SqlResourceInstance, "uno", 50*time.Millisecond,
+		k8s.ReasonUpdateFailed, k8s.ReasonUpdating, k8s.ReasonUpToDate)
+	steps = append(steps,
+		k8stest.Step{Kind: k8s.SqlResourceDatabase, Name: "uno-db", Reason: k8s.ReasonUpToDate},
+		k8stest.Step{Kind: k8s.SqlResourceUser, Name: "uno-user", Reason: k8s.ReasonUpToDate},
+	)
+
+	report := wait(t, c, m, 10*time.Second, steps...)
+	assert.Equal(t, k8s.ExitReady, report.ExitCode(), report.String())
+}
+
+func TestWaitFailsAfterGracePeriod(t *testing.T) {
+	c, m := newTestCluster(t)
+
+	report := wait(t, c, m, 10*time.Second,
+		k8stest.Step{Kind: k8s.SqlResourceInstance, Name: "uno", Reason: k8s.ReasonUpdateFailed, Message: "quota exceeded"})
+	assert.Equal(t, k8s.ExitFailed, report.ExitCode())
+	assert.Equal(t, k8s.StateFailed, resultState(report, "uno"))
+	assert.Equal(t, k8s.StateSkipped, resultState(report, "uno-db"))
+	assert.Equal(t, k8s.ReasonUpdateFailed, result(report, "uno").Reason)
+	assert.Equal(t, "quota exceeded", result(report, "uno").Message)
+}
+
+func TestWaitDeleted(t *testing.T) {
+	c, m := newTestCluster(t)
+	steps := []k8stest.Step{
+		{Kind: k8s.SqlResourceInstance, Name: "uno", Reason: k8s.ReasonUpToDate},
+		{Kind: k8s.SqlResourceUser, Name: "uno-user", Reason: k8s.ReasonUpToDate},
+		{After: 100 * time.Millisecond, Kind: k8s.SqlResourceDatabase, Name: "uno-db", Delete: true},
+	}
+
+	report := wait(t, c, m, 10*time.Second, steps...)
+	assert.Equal(t, k8s.ExitFailed, report.ExitCode())
+	assert.Equal(t, k8s.StateFailed, resultState(report, "uno-db"))
+	assert.Equal(t, k8s.StateReady, resultState(report, "uno-user"))
+}
+
+func TestWaitSurvivesWatchDrop(t *testing.T) {
+	c, m := newTestCluster(t)
+	steps := []k8stest.Step{
+		{Kind: k8s.SqlResourceInstance, Name: "uno", Reason: k8s.ReasonUpToDate},
+		{After: 100 * time.Millisecond, DropWatches: true},
+		{Kind: k8s.SqlResourceDatabase, Name: "uno-db", Reason: k8s.ReasonUpToDate},
+		{Kind: k8s.SqlResourceUser, Name: "uno-user", Reason: k8s.ReasonUpToDate},
+	}
+
+	report := wait(t, c, m, 10*time.Second, steps...)
+	assert.Equal(t, k8s.ExitReady, report.ExitCode(), report.String())
+}
+
+func TestWaitTimeout(t *testing.T) {
+	c, m := newTestCluster(t)
+
+	report := wait(t, c, m, 500*time.Millisecond,
+		k8stest.Step{Kind: k8s.SqlResourceInstance, Name: "uno", Reason: k8s.ReasonUpdating})
+	assert.Equal(t, k8s.ExitTimeout, report.ExitCode(), report.String())
+	assert.Equal(t, k8s.StateTimedOut, resultState(report, "uno"))
+	assert.Equal(t, k8s.StateTimedOut, resultState(report, "uno-db"))
+}
+
+func TestWaitKindTimeout(t *testing.T) {
+	c, m := newTestCluster(t)
+	m.Timeouts = &k8s.Timeouts{Kinds: map[k8s.DependencyType]metav1.Duration{
+		k8s.SqlResourceUser: {Duration: 300 * time.Millisecond},
+	}}
+
+	report := wait(t, c, m, 10*time.Second,
+		k8stest.Step{Kind: k8s.SqlResourceInstance, Name: "uno", Reason: k8s.ReasonUpToDate},
+		k8stest.Step{Kind: k8s.SqlResourceDatabase, Name: "uno-db", Reason: k8s.ReasonUpToDate},
+		k8stest.Step{Kind: k8s.SqlResourceUser, Name: "uno-user", Reason: k8s.ReasonUpdating})
+	assert.Equal(t, k8s.ExitTimeout, report.ExitCode(), report.String())
+	assert.Equal(t, k8s.StateReady, resultState(report, "uno"))
+	assert.Equal(t, k8s.StateReady, resultState(report, "uno-db"))
+	assert.Equal(t, k8s.StateTimedOut, resultState(report, "uno-user"))
+	require.NotNil(t, result(report, "uno-user").Error)
+	assert.Equal(t, "SqlUser timeout of 300ms used up", result(report, "uno-user").Error.Message)
+	assert.Less(t, report.Duration, 5*time.Second, "the rest of the wait isn't held up")
+}
+
+func TestWaitGroupTimeout(t *testing.T) {
+	c, m := newTestCluster(t)
+	m.Instances[0].Timeout = &metav1.Duration{Duration: 300 * time.Millisecond}
+
+	report := wait(t, c, m, 10*time.Second,
+		k8stest.Step{Kind: k8s.SqlResourceInstance, Name: "uno", Reason: k8s.ReasonUpdating})
+	assert.Equal(t, k8s.ExitTimeout, report.ExitCode(), report.String())
+	assert.Equal(t, k8s.StateTimedOut, resultState(report, "uno"))
+	assert.Equal(t, "group uno timeout of 300ms used up", result(report, "uno").Error.Message)
+	assert.Equal(t, k8s.StateTimedOut, resultState(report, "uno-db"))
+	assert.Equal(t, "not waited on, SqlInstance uno timed out first", result(report, "uno-db").Error.Message)
+}
+
+func TestWaitOverallTimeout(t *testing.T) {
+	c, m := newTestCluster(t)
+	m.Timeouts = &k8s.Timeouts{Overall: &metav1.Duration{Duration: time.Minute}}
+	printer, err := k8s.NewPrinter(k8s.OutputText, io.Discard)
+	require.NoError(t, err)
+	// the application's timeouts take precedence over the manifest's
+	app := c.App(k8s.WithWaitTimeouts(k8s.Timeouts{Overall: &metav1.Duration{Duration: 300 * time.Millisecond}}))
+	app.SetPrinter(printer)
+
+	report, err := app.WaitForCloudSQL(context.Background(), m)
+	require.NoError(t, err)
+	assert.Equal(t, k8s.ExitTimeout, report.ExitCode(), report.String())
+	assert.Equal(t, k8s.StateTimedOut, resultState(report, "uno"))
+	assert.Equal(t, "overall timeout of 300ms used up", result(report, "uno").Error.Message)
+}
+
+func TestWaitMissingInstance(t *testing.T) {
+	c := k8stest.NewCluster("default")
+	m, err := k8s.LoadManifest(strings.NewReader(waitManifest))
+	require.NoError(t, err)
+
+	report := wait(t, c, m, 10*time.Second)
+	assert.Equal(t, k8s.ExitFailed, report.ExitCode())
+	assert.Equal(t, k8s.StateFailed, resultState(report, "uno"))
+}
+
+const multiClusterManifest = `
+instances:
+- name: main
+  namespace: team-a
+- name: other
+  namespace: team-b
+- name: main
+  namespace: team-a
+  cluster: dr
+databases:
+- name: main-db
+  instanceName: main
+- name: main-db
+  instanceName: main
+  cluster: dr
+`
+
+func TestWaitMultiNamespaceAndCluster(t *testing.T) {
+	primary := k8stest.NewCluster("default")
+	require.NoError(t, primary.InNamespace("team-a").AddInstance("main"))
+	require.NoError(t, primary.InNamespace("team-a").AddDatabase("main-db", "main"))
+	require.NoError(t, primary.InNamespace("team-b").AddInstance("other"))
+
+	dr := k8stest.NewCluster("team-a")
+	require.NoError(t, dr.AddInstance("main"))
+	require.NoError(t, dr.AddDatabase("main-db", "main"))
+
+	m, err := k8s.LoadManifest(strings.NewReader(multiClusterManifest))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	primaryErrs := primary.Start(ctx,
+		k8stest.Step{Kind: k8s.SqlResourceInstance, Name: "main", Namespace: "team-a", Reason: k8s.ReasonUpToDate},
+		k8stest.Step{Kind: k8s.SqlResourceDatabase, Name: "main-db", Namespace: "team-a", Reason: k8s.ReasonUpToDate},
+		k8stest.Step{Kind: k8s.SqlResourceInstance, Name: "other", Namespace: "team-b", Reason: k8s.ReasonUpToDate},
+	)
+	// The DR instance is still being created when the wait runs out.
+	drErrs := dr.Start(ctx,
+		k8stest.Step{Kind: k8s.SqlResourceInstance, Name: "main", Reason: k8s.ReasonUpdating})
+
+	printer, err := k8s.NewPrinter(k8s.OutputText, io.Discard)
+	require.NoError(t, err)
+	app := primary.App(k8s.WithCluster("dr", dr.App()))
+	app.SetPrinter(printer)
+	report, err := app.WaitForCloudSQL(ctx, m)
+	require.NoError(t, err)
+	require.NoError(t, <-primaryErrs)
+	require.NoError(t, <-drErrs)
+
+	assert.Equal(t, []string{"", "dr"}, report.Clusters())
+	assert.Equal(t, k8s.ExitReady, report.ForCluster("").ExitCode(), report.String())
+	assert.Equal(t, k8s.ExitTimeout, report.ForCluster("dr").ExitCode(), report.String())
+	assert.Equal(t, k8s.ExitTimeout, report.ExitCode())
+
+	for _, r := range report.Resources {
+		if r.Name == "main-db" {
+			assert.Equal(t, "team-a", r.Namespace)
+		}
+	}
+	assert.Contains(t, report.String(), "dr: 0 of 2 resources ready")
+}
+
+const workloadManifest = waitManifest + `
+workloads:
+- kind: Deployment
+  name: api
+  dependsOn: [uno]
+  restart: true
+- kind: Deployment
+  name: web
+  dependsOn: [Deployment/api]
+`
+
+func newTestWorkloads(t *testing.T) (*k8stest.Cluster, *k8s.SqlManifest) {
+	t.Helper()
+	c, _ := newTestCluster(t)
+	require.NoError(t, c.AddDeployment("api", 2))
+	require.NoError(t, c.AddDeployment("web", 1))
+
+	m, err := k8s.LoadManifest(strings.NewReader(workloadManifest))
+	require.NoError(t, err)
+	return c, m
+}
+
+func TestWaitWorkloadsAfterGroup(t *testing.T) {
+	c, m := newTestWorkloads(t)
+	steps := []k8stest.Step{
+		{Kind: k8s.SqlResourceInstance, Name: "uno", Reason: k8s.ReasonUpToDate},
+		{Kind: k8s.SqlResourceDatabase, Name: "uno-db", Reason: k8s.ReasonUpToDate},
+		{Kind: k8s.SqlResourceUser, Name: "uno-user", Reason: k8s.ReasonUpToDate},
+		{After: 100 * time.Millisecond, Name: "api", Rollout: true},
+		{After: 100 * time.Millisecond, Name: "web", Rollout: true},
+	}
+
+	report := wait(t, c, m, 10*time.Second, steps...)
+	assert.Equal(t, k8s.ExitReady, report.ExitCode(), report.String())
+	assert.Equal(t, "uno", result(report, "api").Group)
+	assert.GreaterOrEqual(t, result(report, "api").Duration, result(report, "uno-user").Duration)
+	assert.GreaterOrEqual(t, result(report, "web").Duration, result(report, "api").Duration)
+
+	api, err := c.Kube.AppsV1().Deployments("default").Get(context.TODO(), "api", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, api.Spec.Template.Annotations, "kubectl.kubernetes.io/restartedAt")
+}
+
+func TestWaitWorkloadsSkippedWhenGroupFails(t *testing.T) {
+	c, m := newTestWorkloads(t)
+
+	report := wait(t, c, m, 10*time.Second,
+		k8stest.Step{Kind: k8s.SqlResourceInstance, Name: "uno", Reason: k8s.ReasonUpdateFailed})
+	assert.Equal(t, k8s.ExitFailed, report.ExitCode())
+	assert.Equal(t, k8s.StateSkipped, resultState(report, "api"))
+	assert.Equal(t, k8s.StateSkipped, resultState(report, "web"))
+
+	api, err := c.Kube.AppsV1().Deployments("default").Get(context.TODO(), "api", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, api.Spec.Template.Annotations, "kubectl.kubernetes.io/restartedAt")
+}
+
+func TestWaitWorkloadNotFound(t *testing.T) {
+	c, _ := newTestCluster(t)
+	m, err := k8s.LoadManifest(strings.NewReader(waitManifest + `
+workloads:
+- kind: StatefulSet
+  name: dbb
+  dependsOn: [uno]
+`))
+	require.NoError(t, err)
+
+	start := time.Now()
+	report := wait(t, c, m, 10*time.Second,
+		k8stest.Step{Kind: k8s.SqlResourceInstance, Name: "uno", Reason: k8s.ReasonUpToDate},
+		k8stest.Step{Kind: k8s.SqlResourceDatabase, Name: "uno-db", Reason: k8s.ReasonUpToDate},
+		k8stest.Step{Kind: k8s.SqlResourceUser, Name: "uno-user", Reason: k8s.ReasonUpToDate},
+	)
+	assert.Equal(t, k8s.ExitFailed, report.ExitCode(), report.String())
+	db := result(report, "dbb")
+	assert.Equal(t, k8s.StateFailed, db.State)
+	assert.Equal(t, "NotFound", db.Reason)
+	assert.Equal(t, `statefulsets.apps "dbb" not found`, db.Message)
+	assert.Less(t, time.Since(start), 5*time.Second, "a missing workload should fail straight away")
+}
+
+func TestWaitReportsEvents(t *testing.T) {
+	c, m := newTestCluster(t)
+	require.NoError(t, c.RecordEvent("SQLInstance", "uno", "Warning", "UpdateFailed", "quota exceeded"))
+	require.NoError(t, c.RecordEvent("SQLInstance", "uno", "Warning", "UpdateFailed", "quota exceeded"))
+	require.NoError(t, c.RecordEvent("SQLDatabase", "other-db", "Warning", "UpdateFailed", "not ours"))
+	steps := []k8stest.Step{
+		{After: 100 * time.Millisecond, Kind: k8s.SqlResourceInstance, Name: "uno", Reason: k8s.ReasonUpToDate},
+		{Kind: k8s.SqlResourceDatabase, Name: "uno-db", Reason: k8s.ReasonUpToDate},
+		{Kind: k8s.SqlResourceUser, Name: "uno-user", Reason: k8s.ReasonUpToDate},
+	}
+
+	report := wait(t, c, m, 10*time.Second, steps...)
+	require.Len(t, result(report, "uno").Events, 1)
+	ev := result(report, "uno").Events[0]
+	assert.Equal(t, "UpdateFailed", ev.Reason)
+	assert.Equal(t, int32(2), ev.Count)
+	assert.Empty(t, result(report, "uno-db").Events)
+	assert.Contains(t, report.String(), "Warning SQLInstance/uno UpdateFailed (x2): quota exceeded")
+}
+
+func TestWatchInstance(t *testing.T) {
+	c := k8stest.NewCluster("default")
+	require.NoError(t, c.AddInstance("uno"))
+	require.NoError(t, c.AddInstance("dos"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	changes, err := c.App().WatchInstance(ctx, "uno")
+	require.NoError(t, err)
+
+	change := <-changes
+	require.NoError(t, change.Err)
+	assert.Equal(t, "uno", change.Instance.Name)
+	assert.Equal(t, k8s.ReadinessProgressing, change.Readiness.State)
+
+	require.NoError(t, c.SetReady(k8s.SqlResourceInstance, "dos", k8s.ReasonUpToDate, "dos is ready"))
+	require.NoError(t, c.SetReady(k8s.SqlResourceInstance, "uno", k8s.ReasonUpToDate, "uno is ready"))
+	change = <-changes
+	require.NoError(t, change.Err)
+	assert.Equal(t, "uno", change.Instance.Name)
+	assert.Equal(t, k8s.ReadinessReady, change.Readiness.State)
+
+	cancel()
+	for range changes {
+	}
+}
+
+func TestWatchInstanceFuncStopsOnError(t *testing.T) {
+	c := k8stest.NewCluster("default")
+	require.NoError(t, c.AddInstance("uno"))
+
+	stop := errors.New("stop")
+	err := c.App().WatchInstanceFunc(context.Background(), "uno", func(change k8s.InstanceChange) error {
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+}
+
+func TestWaitLogs(t *testing.T) {
+	c, _ := newTestCluster(t)
+	m, err := k8s.LoadManifest(strings.NewReader(strings.Replace(waitManifest, "200ms", "10s", 1)))
+	require.NoError(t, err)
+	require.NoError(t, c.SetReady(k8s.SqlResourceInstance, "uno", k8s.ReasonUpdateFailed, "quota exceeded"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	errs := c.Start(ctx,
+		k8stest.Step{After: 300 * time.Millisecond, Kind: k8s.SqlResourceInstance, Name: "uno", Reason: k8s.ReasonUpToDate},
+		k8stest.Step{Kind: k8s.SqlResourceDatabase, Name: "uno-db", Reason: k8s.ReasonUpToDate},
+		k8stest.Step{Kind: k8s.SqlResourceUser, Name: "uno-user", Reason: k8s.ReasonUpToDate},
+	)
+
+	var logs bytes.Buffer
+	printer, err := k8s.NewPrinter(k8s.OutputText, io.Discard)
+	require.NoError(t, err)
+	app := c.App(k8s.WithLogger(slog.New(slog.NewJSONHandler(&logs, nil))))
+	app.SetPrinter(printer)
+	report, err := app.WaitForCloudSQL(ctx, m)
+	require.NoError(t, err)
+	require.Equal(t, k8s.ExitReady, report.ExitCode(), report.String())
+	cancel()
+	<-errs
+
+	var failing, ready []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		assert.NotEqual(t, "DEBUG", entry["level"], "debug logs are off by default")
+		switch {
+		case strings.HasPrefix(entry["msg"].(string), "resource failing"):
+			failing = append(failing, entry)
+		case entry["msg"] == "resource ready":
+			ready = append(ready, entry)
+		}
+	}
+
+	require.Len(t, failing, 1)
+	assert.Equal(t, "uno", failing[0]["group"])
+	assert.Equal(t, "SqlInstance", failing[0]["kind"])
+	assert.Equal(t, "uno", failing[0]["name"])
+	assert.Equal(t, "default", failing[0]["namespace"])
+	assert.Equal(t, k8s.ReasonUpdateFailed, failing[0]["reason"])
+	assert.Equal(t, float64(1), failing[0]["attempt"])
+	assert.Contains(t, failing[0], "elapsed")
+	assert.Len(t, ready, 3)
+}
+
+func TestMonitorKeepsWatching(t *testing.T) {
+	c, m := newTestCluster(t)
+	metrics := k8s.NewMetrics()
+	app := c.App(k8s.WithMetrics(metrics), k8s.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events := make(chan k8s.SqlInstanceGroupEvent, 100)
+	done := make(chan error)
+	go func() {
+		done <- app.MonitorCloudSQL(ctx, m, func(e k8s.SqlInstanceGroupEvent) {
+			metrics.Observe(e)
+			events <- e
+		})
+	}()
+
+	next := func(name string, state k8s.ResourceState) k8s.SqlInstanceGroupEvent {
+		t.Helper()
+		for {
+			select {
+			case e := <-events:
+				if e.Name == name && e.State == state {
+					return e
+				}
+			case <-ctx.Done():
+				t.Fatalf("no %s event for %s", state, name)
+			}
+		}
+	}
+
+	require.NoError(t, c.SetReady(k8s.SqlResourceDatabase, "uno-db", k8s.ReasonUpToDate, ""))
+	next("uno-db", k8s.StateReady)
+
+	// a resource that was ready can fail later, and a dropped watch is
+	// picked up again
+	c.DropWatches()
+	require.NoError(t, c.SetReady(k8s.SqlResourceDatabase, "uno-db", k8s.ReasonUpdateFailed, "quota exceeded"))
+	e := next("uno-db", k8s.StateFailed)
+	assert.Equal(t, k8s.ReasonUpdateFailed, e.Condition.Reason)
+
+	require.NoError(t, c.Delete(k8s.SqlResourceUser, "uno-user"))
+	e = next("uno-user", k8s.StateFailed)
+	assert.Equal(t, "NotFound", e.Error.Name)
+
+	cancel()
+	require.NoError(t, <-done)
+	// the database and user watches must have restarted for their changes
+	// to be seen; the instance watch may not have yet
+	assert.GreaterOrEqual(t, testutil.CollectAndCount(metrics, "go_k8s_watch_restarts_total"), 2)
+}
@@ -2,45 +2,56 @@ package k8s
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
-	"time"
 
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/watch"
-	"k8s.io/client-go/tools/cache"
-	toolsWatch "k8s.io/client-go/tools/watch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func (s *SqlInstanceGroupList) Watch() {
 	for _, group := range s.Groups {
+		group.timeouts = s.Timeouts
 		s.wg.Add(1)
 		go group.Watch(s.events, s.wg)
 	}
+	if len(s.Standalone.Resources) > 0 {
+		s.Standalone.timeouts = s.Timeouts
+		s.wg.Add(1)
+		go s.Standalone.Watch(s.events, s.wg)
+	}
+	s.watchWorkloads()
 	s.wg.Wait()
 }
 
 func (s *SqlInstanceGroup) Watch(eventsChan chan<- SqlInstanceGroupEvent, wg *sync.WaitGroup) {
 	defer wg.Done()
-	ctx, cancel := context.WithTimeout(s.ctx, cloudSQLWaitTimeout)
+	defer close(s.done)
+	ctx, cancel := withBudget(s.ctx, "group "+s.Name, s.Timeout)
 	defer cancel()
+	ctx, s.cancel = context.WithCancelCause(ctx)
+	defer s.cancel(nil)
+	s.ctx = ctx
 
-	baseEvent := SqlInstanceGroupEvent{
-		Group: s,
-		Type:  SqlResourceInstance,
-		Name:  s.Name,
-	}
+	if !s.standalone {
+		baseEvent := s.baseEvent(SqlResourceInstance, s.Name, "", "")
 
-	err := s.CheckInstance(ctx)
-	if err != nil {
-		baseEvent.Error = err
-		eventsChan <- baseEvent
-		return
-	}
+		err := s.CheckInstance(ctx)
+		if err != nil {
+			if ctx.Err() != nil && !errors.Is(context.Cause(ctx), errGroupFailed) {
+				err.Message = timeoutError(ctx).Error()
+			}
+			baseEvent.Error = err
+			baseEvent.State = s.errorState()
+			s.send(eventsChan, baseEvent)
+			return
+		}
 
-	if ok := s.WatchInstance(ctx, eventsChan); !ok {
-		eventsChan <- SqlInstanceGroupEvent{}
-		return
+		if ok := s.WatchInstance(ctx, eventsChan); !ok {
+			return
+		}
+		s.warnUnlisted()
 	}
 
 	for _, db := range s.Databases {
@@ -53,219 +64,249 @@ func (s *SqlInstanceGroup) Watch(eventsChan chan<- SqlInstanceGroupEvent, wg *sy
 		go s.WatchUser(eventsChan, user)
 	}
 
+	for _, resource := range s.Resources {
+		s.wg.Add(1)
+		go s.WatchResource(eventsChan, resource)
+	}
+
 	s.wg.Wait()
 }
 
 func (s *SqlInstanceGroup) CheckInstance(ctx context.Context) *AppError {
-	_, err := s.app.cnrmClient.SqlV1beta1().
-		SQLInstances(s.app.namespace).
-		Get(ctx, s.Name, v1.GetOptions{})
+	app, err := s.app.Cluster(s.Cluster)
+	if err != nil {
+		return &AppError{Name: "CheckInstance", Message: fmt.Sprint(err)}
+	}
+	si, err := app.informers().get(ctx, kindResource(mustLookupKind(SqlResourceInstance)), s.namespaceFor(""))
 	if err != nil {
-		return &AppError{Name:"CheckInstance", Message: fmt.Sprint(err)}
+		return &AppError{Name: "CheckInstance", Message: fmt.Sprint(err)}
+	}
+	if _, err := si.lookup(s.Name); err != nil {
+		return &AppError{Name: "CheckInstance", Message: fmt.Sprint(err)}
 	}
 	return nil
 }
 
-func (s *SqlInstanceGroup) CheckDatabase(eventsChan chan<- SqlInstanceGroupEvent, name string) (bool, error) {
-	baseEvent := SqlInstanceGroupEvent{
-		Group: s,
-		Type:  SqlResourceDatabase,
-		Name:  name,
+// CheckDatabase returns the readiness of one of the group's databases, or
+// sends a failure event and returns the error when it can't be found.
+func (s *SqlInstanceGroup) CheckDatabase(eventsChan chan<- SqlInstanceGroupEvent, name string) (Readiness, error) {
+	namespace := ""
+	for _, db := range s.Databases {
+		if db.Name == name {
+			namespace = db.Namespace
+			break
+		}
 	}
+	return s.checkObject(eventsChan, "CheckDatabase", s.baseEvent(SqlResourceDatabase, name, namespace, ""))
+}
 
-	database, err := s.app.cnrmClient.SqlV1beta1().
-		SQLDatabases(s.app.namespace).
-		Get(context.TODO(), name, v1.GetOptions{})
-	if err != nil {
-		baseEvent.Error = &AppError{Name:"CheckDatabase", Message: fmt.Sprint(err)}
-		eventsChan <- baseEvent
-		return false, err
+// CheckUser is CheckDatabase for the group's users.
+func (s *SqlInstanceGroup) CheckUser(eventsChan chan<- SqlInstanceGroupEvent, name string) (Readiness, error) {
+	namespace := ""
+	for _, user := range s.Users {
+		if user.Name == name {
+			namespace = user.Namespace
+			break
+		}
 	}
-	return database.Status.Conditions[0].Reason != "UpdateFailed", nil
+	return s.checkObject(eventsChan, "CheckUser", s.baseEvent(SqlResourceUser, name, namespace, ""))
 }
 
-func (s *SqlInstanceGroup) CheckUser(eventsChan chan<- SqlInstanceGroupEvent, name string) (bool, error) {
-	baseEvent := SqlInstanceGroupEvent{
-		Group: s,
-		Type:  SqlResourceUser,
-		Name:  name,
+func (s *SqlInstanceGroup) checkObject(eventsChan chan<- SqlInstanceGroupEvent, check string, baseEvent SqlInstanceGroupEvent) (Readiness, error) {
+	obj, err := s.lookupObject(baseEvent)
+	if err != nil {
+		baseEvent.Error = &AppError{Name: check, Message: fmt.Sprint(err)}
+		baseEvent.State = s.errorState()
+		s.send(eventsChan, baseEvent)
+		return Readiness{}, err
 	}
+	return ObjectReadiness(obj)
+}
 
-	database, err := s.app.cnrmClient.SqlV1beta1().
-		SQLUsers(s.app.namespace).
-		Get(context.TODO(), name, v1.GetOptions{})
+// lookupObject returns the object of baseEvent from its shared informer.
+func (s *SqlInstanceGroup) lookupObject(baseEvent SqlInstanceGroupEvent) (*unstructured.Unstructured, error) {
+	app, err := s.app.Cluster(baseEvent.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	si, err := app.informers().get(s.ctx, kindResource(mustLookupKind(baseEvent.Type)), baseEvent.Namespace)
 	if err != nil {
-		baseEvent.Error = &AppError{Name:"CheckUser", Message: fmt.Sprint(err)}
-		eventsChan <- baseEvent
-		return false, err
+		return nil, err
 	}
-	return database.Status.Conditions[0].Reason != "UpdateFailed", nil
+	return si.lookup(baseEvent.Name)
 }
 
-func (s *SqlInstanceGroup) WatchInstance(ctx context.Context, eventsChan chan<- SqlInstanceGroupEvent) bool {
-	baseEvent := SqlInstanceGroupEvent{
-		Group: s,
-		Type:  SqlResourceInstance,
-		Name:  s.Name,
+// errorState decides whether a resource that stopped being watched because of
+// an error failed, simply ran out of time, or was stopped because another
+// resource in a fail-fast group failed.
+func (s *SqlInstanceGroup) errorState() ResourceState {
+	switch {
+	case errors.Is(context.Cause(s.ctx), errGroupFailed):
+		return StateSkipped
+	case errors.Is(s.ctx.Err(), context.DeadlineExceeded):
+		return StateTimedOut
 	}
+	return StateFailed
+}
 
-	rw, err := toolsWatch.NewRetryWatcher(
-		"1",
-		&cache.ListWatch{WatchFunc: s.getInstanceWatchFunc(s.Name)})
-	defer rw.Stop()
-	if err != nil {
-		eventsChan <- baseEvent
-		return false
+// failureState is errorState for errors returned by watchEvents, which fail
+// the resource outright when it is stuck in a terminal state, and time it
+// out when it used up a budget of its own.
+func (s *SqlInstanceGroup) failureState(err error) ResourceState {
+	var terr *terminalError
+	var berr *budgetError
+	switch {
+	case errors.As(err, &terr):
+		return StateFailed
+	case errors.As(err, &berr):
+		return StateTimedOut
 	}
+	return s.errorState()
+}
 
-	if err := s.watchEvents(rw, eventsChan, baseEvent); err != nil {
-		baseEvent.Error = &AppError{Name:"WatchInstance", Message: fmt.Sprint(err)}
-		eventsChan <- baseEvent
-		return false
+// send forwards an event and, when the group fails fast, stops the rest of
+// the group once a resource has failed. It also marks the group as failed
+// for the workloads that depend on it.
+func (s *SqlInstanceGroup) send(eventsChan chan<- SqlInstanceGroupEvent, event SqlInstanceGroupEvent) {
+	if event.State != StateReady && event.State != StatePending {
+		s.failed.Store(true)
+	}
+	eventsChan <- event
+	if event.State == StateFailed && s.Policy.FailFast && s.cancel != nil {
+		s.cancel(errGroupFailed)
 	}
+}
 
+func (s *SqlInstanceGroup) WatchInstance(ctx context.Context, eventsChan chan<- SqlInstanceGroupEvent) bool {
+	baseEvent := s.baseEvent(SqlResourceInstance, s.Name, "", "")
+
+	if err := s.watchObject(eventsChan, baseEvent, mustLookupKind(SqlResourceInstance)); err != nil {
+		baseEvent.Error = &AppError{Name: "WatchInstance", Message: fmt.Sprint(err)}
+		baseEvent.State = s.failureState(err)
+		s.send(eventsChan, baseEvent)
+		return false
+	}
 	return true
 }
 
 func (s *SqlInstanceGroup) WatchDatabase(eventsChan chan<- SqlInstanceGroupEvent, db *SqlDatabase) {
 	defer s.wg.Done()
 
-	// config connector resources may initialize with UpdateFailed
-	// wait until these resources are updated to continue
-	ticker := time.NewTicker(resourceCheckInterval)
-	databaseOk := false
-	for {
-		select {
-		case <-ticker.C:
-			ok, err := s.CheckDatabase(eventsChan, db.Name)
-			if err != nil {
-				fmt.Printf("%s CheckDatabase err\n", db.Name)
-				return
-			}
-			if ok {
-				fmt.Printf("%s CheckDatabase ok\n", db.Name)
-				databaseOk = true
-			}
-		case <-s.ctx.Done():
-			fmt.Printf("%s CheckDatabase timeout\n", db.Name)
-			return
-		}
-		if databaseOk {
-			break
-		}
-	}
+	baseEvent := s.baseEvent(SqlResourceDatabase, db.Name, db.Namespace, "")
 
-	baseEvent := SqlInstanceGroupEvent{
-		Group: s,
-		Type:  SqlResourceDatabase,
-		Name:  db.Name,
+	if err := s.watchObject(eventsChan, baseEvent, mustLookupKind(SqlResourceDatabase)); err != nil {
+		baseEvent.Error = &AppError{Name: "WatchDatabase", Message: fmt.Sprint(err)}
+		baseEvent.State = s.failureState(err)
+		s.send(eventsChan, baseEvent)
 	}
+}
 
-	rw, err := toolsWatch.NewRetryWatcher(
-		"1",
-		&cache.ListWatch{WatchFunc: s.getDatabaseWatchFunc(db.Name)})
-	defer rw.Stop()
-	if err != nil {
-		baseEvent.Error = &AppError{Name:"WatchDatabase", Message: fmt.Sprint(err)}
-		eventsChan <- baseEvent
-		return
-	}
+func (s *SqlInstanceGroup) WatchUser(eventsChan chan<- SqlInstanceGroupEvent, user *SqlUser) {
+	defer s.wg.Done()
 
-	if err := s.watchEvents(rw, eventsChan, baseEvent); err != nil {
-		eventsChan <- baseEvent
+	baseEvent := s.baseEvent(SqlResourceUser, user.Name, user.Namespace, "")
+
+	if err := s.watchObject(eventsChan, baseEvent, mustLookupKind(SqlResourceUser)); err != nil {
+		baseEvent.Error = &AppError{Name: "WatchUser", Message: fmt.Sprint(err)}
+		baseEvent.State = s.failureState(err)
+		s.send(eventsChan, baseEvent)
 	}
 }
 
-func (s *SqlInstanceGroup) WatchUser(eventsChan chan<- SqlInstanceGroupEvent, user *SqlUser) {
+// WatchResource waits on any Config Connector kind.
+func (s *SqlInstanceGroup) WatchResource(eventsChan chan<- SqlInstanceGroupEvent, resource *KccResource) {
 	defer s.wg.Done()
 
-	// config connector resources may initialize with UpdateFailed
-	// wait until these resources are updated to continue
-	ticker := time.NewTicker(resourceCheckInterval)
-	userOk := false
-	for {
-		select {
-		case <-ticker.C:
-			ok, err := s.CheckUser(eventsChan, user.Name)
-			if err != nil {
-				fmt.Printf("%s CheckUser err\n", user.Name)
-				return
-			}
-			if ok {
-				fmt.Printf("%s CheckUser ok\n", user.Name)
-				userOk = true
-			}
-		case <-s.ctx.Done():
-			fmt.Printf("%s CheckUser timeout\n", user.Name)
-			return
-		}
-		if userOk {
-			break
-		}
-	}
+	baseEvent := s.baseEvent(resource.Kind, resource.Name, resource.Namespace, resource.Cluster)
 
-	baseEvent := SqlInstanceGroupEvent{
-		Group: s,
-		Type:  SqlResourceUser,
-		Name:  user.Name,
+	gvk, err := resource.GroupVersionKind()
+	if err == nil {
+		err = s.watchObject(eventsChan, baseEvent, gvk)
 	}
-
-	rw, err := toolsWatch.NewRetryWatcher(
-		"1",
-		&cache.ListWatch{WatchFunc: s.getUserWatchFunc(user.Name)})
-	defer rw.Stop()
 	if err != nil {
-		baseEvent.Error = &AppError{Name:"WatchUser", Message: fmt.Sprint(err)}
-		eventsChan <- baseEvent
-		return
+		baseEvent.Error = &AppError{Name: "WatchResource", Message: fmt.Sprint(err)}
+		baseEvent.State = s.failureState(err)
+		s.send(eventsChan, baseEvent)
 	}
+}
 
-	if err := s.watchEvents(rw, eventsChan, baseEvent); err != nil {
-		eventsChan <- baseEvent
+// baseEvent returns the event template for a resource of the group, with
+// the namespace and cluster it lives in resolved.
+func (s *SqlInstanceGroup) baseEvent(t DependencyType, name, namespace, cluster string) SqlInstanceGroupEvent {
+	return SqlInstanceGroupEvent{
+		Group:     s,
+		Type:      t,
+		Name:      name,
+		Namespace: s.namespaceFor(namespace),
+		Cluster:   s.clusterFor(cluster),
 	}
 }
 
-func (s *SqlInstanceGroup) getInstanceWatchFunc(name string) func(_ v1.ListOptions) (watch.Interface, error) {
-	return func(_ v1.ListOptions) (watch.Interface, error) {
-		var watch watch.Interface
-
-		watch, err := s.app.cnrmClient.SqlV1beta1().
-			SQLInstances(s.app.namespace).
-			Watch(s.ctx, v1.ListOptions{FieldSelector: "metadata.name=" + name})
+// watchObject subscribes to the shared informer for the object's kind and
+// waits until the object is ready, within the budget of its kind. A missing
+// object is a terminal error.
+func (s *SqlInstanceGroup) watchObject(eventsChan chan<- SqlInstanceGroupEvent, baseEvent SqlInstanceGroupEvent, gvk schema.GroupVersionKind) error {
+	ctx, cancel := withBudget(s.ctx, string(baseEvent.Type), s.timeouts.kind(baseEvent.Type))
+	defer cancel()
 
-		if err != nil {
-			return watch, err
+	app, err := s.app.Cluster(baseEvent.Cluster)
+	if err != nil {
+		return err
+	}
+	si, err := app.informers().get(ctx, kindResource(gvk), baseEvent.Namespace)
+	if err != nil {
+		if ctx.Err() != nil && !errors.Is(context.Cause(ctx), errGroupFailed) {
+			return timeoutError(ctx)
 		}
-		return watch, nil
+		return err
+	}
+	if _, err := si.lookup(baseEvent.Name); err != nil {
+		return &terminalError{Reason: "NotFound", Message: err.Error()}
 	}
-}
-
-func (s *SqlInstanceGroup) getDatabaseWatchFunc(name string) func(_ v1.ListOptions) (watch.Interface, error) {
-	return func(_ v1.ListOptions) (watch.Interface, error) {
-		var watch watch.Interface
 
-		watch, err := s.app.cnrmClient.SqlV1beta1().
-			SQLDatabases(s.app.namespace).
-			Watch(s.ctx, v1.ListOptions{FieldSelector: "metadata.name=" + name})
+	sub := si.subscribe(baseEvent.Name)
+	defer sub.Stop()
 
-		if err != nil {
-			return watch, err
-		}
-		return watch, nil
-	}
+	return s.watchEvents(ctx, sub, eventsChan, baseEvent)
 }
 
-func (s *SqlInstanceGroup) getUserWatchFunc(name string) func(_ v1.ListOptions) (watch.Interface, error) {
-	return func(_ v1.ListOptions) (watch.Interface, error) {
-		var watch watch.Interface
+// warnUnlisted points out databases and users that belong to the instance
+// according to their spec.instanceRef but aren't part of the group, as they
+// are easy to forget in a manifest.
+func (s *SqlInstanceGroup) warnUnlisted() {
+	app, err := s.app.Cluster(s.Cluster)
+	if err != nil {
+		return
+	}
+	namespace := s.namespaceFor("")
 
-		watch, err := s.app.cnrmClient.SqlV1beta1().
-			SQLUsers(s.app.namespace).
-			Watch(s.ctx, v1.ListOptions{FieldSelector: "metadata.name=" + name})
+	listed := make(map[DependencyType]map[string]bool)
+	listed[SqlResourceDatabase] = make(map[string]bool)
+	for _, db := range s.Databases {
+		if s.namespaceFor(db.Namespace) == namespace {
+			listed[SqlResourceDatabase][db.Name] = true
+		}
+	}
+	listed[SqlResourceUser] = make(map[string]bool)
+	for _, user := range s.Users {
+		if s.namespaceFor(user.Namespace) == namespace {
+			listed[SqlResourceUser][user.Name] = true
+		}
+	}
 
+	for _, t := range []DependencyType{SqlResourceDatabase, SqlResourceUser} {
+		si, err := app.informers().get(s.ctx, kindResource(mustLookupKind(t)), namespace)
 		if err != nil {
-			return watch, err
+			continue
+		}
+		names, err := si.byInstanceRef(s.Name)
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			if !listed[t][name] {
+				s.app.resourceLogger(s.baseEvent(t, name, "", "")).Warn("resource references the instance but isn't being waited on")
+			}
 		}
-		return watch, nil
 	}
-}
\ No newline at end of file
+}
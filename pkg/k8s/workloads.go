@@ -0,0 +1,609 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-config-connector/pkg/clients/generated/apis/k8s/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	WorkloadDeployment  DependencyType = "Deployment"
+	WorkloadStatefulSet DependencyType = "StatefulSet"
+	WorkloadDaemonSet   DependencyType = "DaemonSet"
+)
+
+// restartedAtAnnotation is set on the pod template by kubectl rollout restart.
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// Reasons of the conditions workload events carry, besides Progressing and
+// reasonProgressDeadlineExceeded.
+const (
+	reasonRolledOut     = "RolledOut"
+	reasonRolloutFailed = "RolloutFailed"
+	reasonRestartFailed = "RestartFailed"
+)
+
+// Workload is a Deployment, StatefulSet or DaemonSet that is rolled out once
+// everything it depends on is ready. DependsOn names SQL instances, whose
+// databases, users and resources must be ready too, and other workloads as
+// Kind/name. Like databases and users, dependencies are found in the same
+// cluster, and in Namespace when it is set. Namespace defaults to the
+// namespace of the cluster's kubeconfig context.
+type Workload struct {
+	Kind      DependencyType `yaml:"kind" json:"kind"`
+	Name      string         `yaml:"name" json:"name"`
+	Namespace string         `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Cluster   string         `yaml:"cluster,omitempty" json:"cluster,omitempty"`
+	DependsOn []string       `yaml:"dependsOn,omitempty" json:"dependsOn,omitempty"`
+	// Restart triggers a new rollout, like kubectl rollout restart, before
+	// waiting on it.
+	Restart bool `yaml:"restart,omitempty" json:"restart,omitempty"`
+}
+
+func isWorkloadKind(kind DependencyType) bool {
+	return kind == WorkloadDeployment || kind == WorkloadStatefulSet || kind == WorkloadDaemonSet
+}
+
+func (w *Workload) ref() string {
+	return string(w.Kind) + "/" + w.Name
+}
+
+// splitWorkloadRef splits a Kind/name dependency. Anything else names an
+// instance.
+func splitWorkloadRef(dep string) (DependencyType, string, bool) {
+	kind, name, ok := strings.Cut(dep, "/")
+	return DependencyType(kind), name, ok
+}
+
+// matches reports whether a dependency of w refers to other.
+func (w *Workload) matches(kind DependencyType, name string, other *Workload) bool {
+	return other.Kind == kind && other.Name == name && other.Cluster == w.Cluster &&
+		(w.Namespace == "" || other.Namespace == "" || other.Namespace == w.Namespace)
+}
+
+// workloadGraph holds, for each workload, the workloads it depends on.
+type workloadGraph [][]int
+
+// newWorkloadGraph links the workloads by their Kind/name dependencies.
+// Unknown dependencies are left out; SqlManifest.Validate reports them.
+func newWorkloadGraph(workloads []*Workload) workloadGraph {
+	g := make(workloadGraph, len(workloads))
+	for i, w := range workloads {
+		for _, dep := range w.DependsOn {
+			kind, name, ok := splitWorkloadRef(dep)
+			if !ok {
+				continue
+			}
+			for j, other := range workloads {
+				if w.matches(kind, name, other) {
+					g[i] = append(g[i], j)
+					break
+				}
+			}
+		}
+	}
+	return g
+}
+
+// cycle returns a dependency cycle as a path that starts and ends with the
+// same workload, or nil when there is none.
+func (g workloadGraph) cycle() []int {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(g))
+	var path []int
+
+	var visit func(i int) []int
+	visit = func(i int) []int {
+		state[i] = visiting
+		path = append(path, i)
+		for _, j := range g[i] {
+			switch state[j] {
+			case visiting:
+				for k := range path {
+					if path[k] == j {
+						return append(append([]int{}, path[k:]...), j)
+					}
+				}
+			case unvisited:
+				if cycle := visit(j); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		return nil
+	}
+
+	for i := range g {
+		if state[i] == unvisited {
+			if cycle := visit(i); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// stages returns the stage of each workload: one after the last workload it
+// depends on, and at least first. The graph must not have a cycle.
+func (g workloadGraph) stages(first func(i int) int) []int {
+	stages := make([]int, len(g))
+	done := make([]bool, len(g))
+	var stage func(i int) int
+	stage = func(i int) int {
+		if !done[i] {
+			stages[i] = first(i)
+			for _, j := range g[i] {
+				if next := stage(j) + 1; next > stages[i] {
+					stages[i] = next
+				}
+			}
+			done[i] = true
+		}
+		return stages[i]
+	}
+	for i := range g {
+		stage(i)
+	}
+	return stages
+}
+
+func cycleError(workloads []*Workload, cycle []int) error {
+	refs := make([]string, len(cycle))
+	for i, j := range cycle {
+		refs[i] = workloads[j].ref()
+	}
+	return fmt.Errorf("dependency cycle: %s", strings.Join(refs, " -> "))
+}
+
+// AddWorkload adds a workload and makes it a dependent of the groups of the
+// instances it depends on.
+func (s *SqlInstanceGroupList) AddWorkload(w Workload) {
+	for _, other := range s.Workloads {
+		if other.Kind == w.Kind && other.Name == w.Name &&
+			other.Namespace == w.Namespace && other.Cluster == w.Cluster {
+			return
+		}
+	}
+	workload := &w
+	s.Workloads = append(s.Workloads, workload)
+	for _, dep := range w.DependsOn {
+		if _, _, ok := splitWorkloadRef(dep); ok {
+			continue
+		}
+		if group := s.instanceGroup(dep, w.Cluster, w.Namespace); group != nil {
+			group.Dependents = append(group.Dependents, workload)
+		}
+	}
+}
+
+// Plan is the order a wait runs in. Everything in a stage is waited on at
+// once, and nothing starts before what it depends on in earlier stages is
+// ready.
+type Plan struct {
+	Stages [][]PlanStep
+}
+
+// PlanStep is a SQL instance with its databases, users and resources, a
+// standalone resource, or a workload.
+type PlanStep struct {
+	Type      DependencyType
+	Name      string
+	Namespace string
+	Cluster   string
+	DependsOn []string
+	Restart   bool
+	// Children counts the databases, users and resources of an instance.
+	Children int
+}
+
+// Plan orders the groups and workloads. The SQL groups come first, then each
+// workload one stage after the last thing it depends on.
+func (s *SqlInstanceGroupList) Plan() (*Plan, error) {
+	graph := newWorkloadGraph(s.Workloads)
+	if cycle := graph.cycle(); cycle != nil {
+		return nil, cycleError(s.Workloads, cycle)
+	}
+
+	var first []PlanStep
+	for _, g := range s.Groups {
+		first = append(first, PlanStep{
+			Type:      SqlResourceInstance,
+			Name:      g.Name,
+			Namespace: g.namespaceFor(""),
+			Cluster:   g.Cluster,
+			Children:  len(g.Databases) + len(g.Users) + len(g.Resources),
+		})
+	}
+	for _, r := range s.Standalone.Resources {
+		first = append(first, PlanStep{
+			Type:      r.Kind,
+			Name:      r.Name,
+			Namespace: s.Standalone.namespaceFor(r.Namespace),
+			Cluster:   r.Cluster,
+		})
+	}
+
+	plan := &Plan{}
+	if len(first) > 0 {
+		plan.Stages = append(plan.Stages, first)
+	}
+	afterGroups := len(plan.Stages)
+	stages := graph.stages(func(i int) int {
+		if dependsOnInstance(s.Workloads[i]) {
+			return afterGroups
+		}
+		return 0
+	})
+	for i, stage := range stages {
+		w := s.Workloads[i]
+		for len(plan.Stages) <= stage {
+			plan.Stages = append(plan.Stages, nil)
+		}
+		plan.Stages[stage] = append(plan.Stages[stage], PlanStep{
+			Type:      w.Kind,
+			Name:      w.Name,
+			Namespace: s.workloadNamespace(w),
+			Cluster:   w.Cluster,
+			DependsOn: w.DependsOn,
+			Restart:   w.Restart,
+		})
+	}
+	return plan, nil
+}
+
+func dependsOnInstance(w *Workload) bool {
+	for _, dep := range w.DependsOn {
+		if _, _, ok := splitWorkloadRef(dep); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Plan) String() string {
+	str := strings.Builder{}
+	for i, stage := range p.Stages {
+		fmt.Fprintf(&str, "Stage %d:\n", i+1)
+		for _, step := range stage {
+			str.WriteString("  ")
+			if step.Cluster != "" {
+				str.WriteString(step.Cluster)
+				str.WriteString(": ")
+			}
+			fmt.Fprintf(&str, "%s %s/%s", step.Type, step.Namespace, step.Name)
+			if step.Type == SqlResourceInstance {
+				fmt.Fprintf(&str, " with %d databases, users and resources", step.Children)
+			}
+			if len(step.DependsOn) > 0 {
+				fmt.Fprintf(&str, " after %s", strings.Join(step.DependsOn, ", "))
+			}
+			if step.Restart {
+				str.WriteString(", restarted")
+			}
+			str.WriteRune('\n')
+		}
+	}
+	return str.String()
+}
+
+// PlanManifest returns the order WaitForCloudSQL would wait on the manifest
+// in.
+func (app *Application) PlanManifest(ctx context.Context, m *SqlManifest) (*Plan, error) {
+	groups := NewSqlInstanceGroupList(ctx, app)
+	if err := groups.InitGroupsFromManifest(m); err != nil {
+		return nil, err
+	}
+	return groups.Plan()
+}
+
+func (s *SqlInstanceGroupList) workloadNamespace(w *Workload) string {
+	if w.Namespace != "" {
+		return w.Namespace
+	}
+	if app, err := s.app.Cluster(w.Cluster); err == nil {
+		return app.namespace
+	}
+	return s.app.namespace
+}
+
+// workloadEvent returns the event template for a workload. It belongs to the
+// group of the first instance it depends on, so that it is skipped in the
+// report when that instance fails.
+func (s *SqlInstanceGroupList) workloadEvent(w *Workload) SqlInstanceGroupEvent {
+	event := SqlInstanceGroupEvent{
+		Type:      w.Kind,
+		Name:      w.Name,
+		Namespace: s.workloadNamespace(w),
+		Cluster:   w.Cluster,
+	}
+	for _, dep := range w.DependsOn {
+		if _, _, ok := splitWorkloadRef(dep); !ok {
+			event.Group = s.instanceGroup(dep, w.Cluster, w.Namespace)
+			break
+		}
+	}
+	return event
+}
+
+// workloadRun tracks a workload while it is waited on. ready is set before
+// done is closed.
+type workloadRun struct {
+	*Workload
+	done  chan struct{}
+	ready bool
+	after []*workloadRun
+}
+
+// watchWorkloads starts waiting on every workload. Each one waits for its
+// dependencies first, and is skipped when any of them isn't ready.
+func (s *SqlInstanceGroupList) watchWorkloads() {
+	runs := make([]*workloadRun, len(s.Workloads))
+	for i, w := range s.Workloads {
+		runs[i] = &workloadRun{Workload: w, done: make(chan struct{})}
+	}
+	for i, deps := range newWorkloadGraph(s.Workloads) {
+		for _, j := range deps {
+			runs[i].after = append(runs[i].after, runs[j])
+		}
+	}
+	for _, run := range runs {
+		s.wg.Add(1)
+		go s.watchWorkload(run)
+	}
+}
+
+func (s *SqlInstanceGroupList) watchWorkload(run *workloadRun) {
+	defer s.wg.Done()
+	defer close(run.done)
+
+	baseEvent := s.workloadEvent(run.Workload)
+	fail := func(state ResourceState, reason string, err error) {
+		event := baseEvent
+		event.State = state
+		event.Condition = workloadCondition(corev1.ConditionFalse, reason, err.Error())
+		event.Error = &AppError{Name: "WatchWorkload", Message: err.Error()}
+		s.events <- event
+	}
+
+	if err := s.waitForDependencies(run); err != nil {
+		state := StateSkipped
+		if errors.Is(err, context.DeadlineExceeded) {
+			state = StateTimedOut
+		}
+		fail(state, ReasonDependencyNotReady, err)
+		return
+	}
+
+	// the budget of the workload's kind starts once its dependencies are
+	// ready
+	ctx, cancel := withBudget(s.ctx, string(run.Kind), s.Timeouts.kind(run.Kind))
+	defer cancel()
+
+	app, err := s.app.Cluster(run.Cluster)
+	if err == nil && run.Restart {
+		err = app.restartWorkload(ctx, run.Kind, baseEvent.Namespace, run.Name)
+	}
+	if err != nil {
+		fail(StateFailed, reasonRestartFailed, err)
+		return
+	}
+
+	status, err := app.waitForWorkloadRollout(ctx, run.Kind, baseEvent.Namespace, run.Name, func(status RolloutStatus) {
+		event := baseEvent
+		event.State = StatePending
+		event.Condition = workloadCondition(corev1.ConditionFalse, "Progressing", status.Message)
+		s.events <- event
+	})
+	var rerr *RolloutError
+	if errors.As(err, &rerr) {
+		logger := s.app.resourceLogger(baseEvent)
+		for _, pod := range rerr.Pods {
+			logger.Warn("pod holding up the rollout", "pod", pod.Name, logKeyReason, pod.Reason, "logs", strings.Join(pod.Logs, "\n"))
+		}
+	}
+	switch {
+	case err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded):
+		var berr *budgetError
+		if errors.As(context.Cause(ctx), &berr) {
+			err = fmt.Errorf("%w: %w", berr, err)
+		}
+		fail(StateTimedOut, "Progressing", err)
+	case err != nil:
+		reason := reasonRolloutFailed
+		switch {
+		case apierrors.IsNotFound(err):
+			reason = "NotFound"
+		case status != nil && status.Failed:
+			reason = reasonProgressDeadlineExceeded
+		}
+		fail(StateFailed, reason, err)
+	default:
+		event := baseEvent
+		event.State = StateReady
+		event.Condition = workloadCondition(corev1.ConditionTrue, reasonRolledOut, status.Message)
+		s.events <- event
+		run.ready = true
+	}
+}
+
+// waitForDependencies waits until the groups and workloads run depends on
+// are done, and fails unless they are all ready.
+func (s *SqlInstanceGroupList) waitForDependencies(run *workloadRun) error {
+	for _, dep := range run.DependsOn {
+		if _, _, ok := splitWorkloadRef(dep); ok {
+			continue
+		}
+		group := s.instanceGroup(dep, run.Cluster, run.Namespace)
+		if group == nil {
+			return fmt.Errorf("depends on unknown instance %q", dep)
+		}
+		select {
+		case <-group.done:
+		case <-s.ctx.Done():
+			return fmt.Errorf("waiting for %s %s: %w", SqlResourceInstance, dep, s.ctx.Err())
+		}
+		if group.failed.Load() {
+			return fmt.Errorf("%s %s is not ready", SqlResourceInstance, dep)
+		}
+	}
+	for _, after := range run.after {
+		select {
+		case <-after.done:
+		case <-s.ctx.Done():
+			return fmt.Errorf("waiting for %s: %w", after.ref(), s.ctx.Err())
+		}
+		if !after.ready {
+			return fmt.Errorf("%s is not ready", after.ref())
+		}
+	}
+	return nil
+}
+
+// workloadCondition stands in for the Ready condition Config Connector
+// resources have, so workloads show up in the output like them.
+func workloadCondition(status corev1.ConditionStatus, reason, message string) *v1alpha1.Condition {
+	return &v1alpha1.Condition{
+		Type:               conditionTypeReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// restartWorkload changes the pod template the same way kubectl rollout
+// restart does, which makes the controller roll out new pods.
+func (app *Application) restartWorkload(ctx context.Context, kind DependencyType, namespace, name string) error {
+	patch := []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`,
+		restartedAtAnnotation, time.Now().Format(time.RFC3339)))
+	apps := app.kubeClient.AppsV1()
+
+	var err error
+	switch kind {
+	case WorkloadDeployment:
+		_, err = apps.Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	case WorkloadStatefulSet:
+		_, err = apps.StatefulSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	case WorkloadDaemonSet:
+		_, err = apps.DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	default:
+		err = fmt.Errorf("can't restart kind %s", kind)
+	}
+	if err != nil {
+		return fmt.Errorf("restart %s %s: %w", kind, name, err)
+	}
+	return nil
+}
+
+// waitForWorkloadRollout waits for the rollout of any workload kind. Errors
+// are RolloutErrors.
+func (app *Application) waitForWorkloadRollout(
+	ctx context.Context,
+	kind DependencyType,
+	namespace, name string,
+	progress func(RolloutStatus),
+) (*RolloutStatus, error) {
+	var (
+		lw       cache.ListerWatcher
+		resource schema.GroupResource
+		evaluate func(runtime.Object) (RolloutStatus, bool)
+	)
+	switch kind {
+	case WorkloadDeployment:
+		return app.waitForDeploymentRollout(ctx, namespace, name, progress)
+	case WorkloadStatefulSet:
+		lw = app.statefulSetListWatch(ctx, namespace, name)
+		resource = appsv1.Resource("statefulsets")
+		evaluate = func(obj runtime.Object) (RolloutStatus, bool) {
+			sts, ok := obj.(*appsv1.StatefulSet)
+			if !ok {
+				return RolloutStatus{}, false
+			}
+			return EvaluateStatefulSetRollout(sts), true
+		}
+	case WorkloadDaemonSet:
+		lw = app.daemonSetListWatch(ctx, namespace, name)
+		resource = appsv1.Resource("daemonsets")
+		evaluate = func(obj runtime.Object) (RolloutStatus, bool) {
+			ds, ok := obj.(*appsv1.DaemonSet)
+			if !ok {
+				return RolloutStatus{}, false
+			}
+			return EvaluateDaemonSetRollout(ds), true
+		}
+	default:
+		return nil, fmt.Errorf("can't wait on the rollout of kind %s", kind)
+	}
+
+	status, last, err := waitForRollout(ctx, lw, resource, strings.ToLower(string(kind)), name, evaluate, progress)
+	if last == nil {
+		return nil, err
+	}
+	if err != nil {
+		rerr := &RolloutError{Status: status, Err: err}
+		// ctx is done, so the holdups are looked up under a deadline of
+		// their own.
+		lookupCtx, cancel := context.WithTimeout(context.Background(), holdupLookupTimeout)
+		defer cancel()
+		switch obj := last.(type) {
+		case *appsv1.StatefulSet:
+			rerr.Pods = app.podHoldups(lookupCtx, namespace, obj.Spec.Selector, obj)
+		case *appsv1.DaemonSet:
+			rerr.Pods = app.podHoldups(lookupCtx, namespace, obj.Spec.Selector, obj)
+		}
+		return &status, rerr
+	}
+	return &status, nil
+}
+
+// statefulSetListWatch lists and watches a single StatefulSet by name.
+func (app *Application) statefulSetListWatch(ctx context.Context, namespace, name string) *cache.ListWatch {
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", name).String()
+	statefulSets := app.kubeClient.AppsV1().StatefulSets(namespace)
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return statefulSets.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return statefulSets.Watch(ctx, options)
+		},
+	}
+}
+
+// daemonSetListWatch lists and watches a single DaemonSet by name.
+func (app *Application) daemonSetListWatch(ctx context.Context, namespace, name string) *cache.ListWatch {
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", name).String()
+	daemonSets := app.kubeClient.AppsV1().DaemonSets(namespace)
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return daemonSets.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return daemonSets.Watch(ctx, options)
+		},
+	}
+}
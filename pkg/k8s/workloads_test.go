@@ -0,0 +1,112 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testWorkloadManifest = `
+instances:
+- name: uno
+databases:
+- name: uno-db
+  instanceName: uno
+resources:
+- kind: StorageBucket
+  name: assets
+workloads:
+- kind: Deployment
+  name: api
+  dependsOn: [uno]
+- kind: StatefulSet
+  name: worker
+  dependsOn: [uno, Deployment/api]
+  restart: true
+- kind: DaemonSet
+  name: agent
+`
+
+func TestPlan(t *testing.T) {
+	m, err := LoadManifest(strings.NewReader(testWorkloadManifest))
+	require.NoError(t, err)
+
+	sig := NewSqlInstanceGroupList(context.TODO(), newTestApp("default", nil, nil, nil))
+	require.NoError(t, sig.InitGroupsFromManifest(m))
+	assert.Equal(t, []*Workload{&m.Workloads[0], &m.Workloads[1]}, sig.GetGroup("uno").Dependents)
+
+	plan, err := sig.Plan()
+	require.NoError(t, err)
+	assert.Equal(t, `Stage 1:
+  SqlInstance default/uno with 1 databases, users and resources
+  StorageBucket default/assets
+  DaemonSet default/agent
+Stage 2:
+  Deployment default/api after uno
+Stage 3:
+  StatefulSet default/worker after uno, Deployment/api, restarted
+`, plan.String())
+}
+
+func TestLoadManifestWorkloadsInvalid(t *testing.T) {
+	_, err := LoadManifest(strings.NewReader(`
+instances:
+- name: uno
+workloads:
+- kind: Deployment
+  name: api
+  dependsOn: [dos, Deployment/web]
+- kind: Deployment
+  name: web
+  dependsOn: [StatefulSet/worker]
+- kind: StatefulSet
+  name: worker
+  dependsOn: [Deployment/web]
+- kind: CronJob
+  name: nightly
+`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `workload "Deployment/api" references unknown instance "dos"`)
+	assert.Contains(t, err.Error(), "workloads[3]: kind must be Deployment, StatefulSet or DaemonSet")
+	assert.Contains(t, err.Error(), "dependency cycle: Deployment/web -> StatefulSet/worker -> Deployment/web")
+}
+
+func TestEvaluateStatefulSetRollout(t *testing.T) {
+	replicas := int32(3)
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Generation: 1},
+		Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+		Status: appsv1.StatefulSetStatus{
+			ObservedGeneration: 1,
+			ReadyReplicas:      2,
+			CurrentRevision:    "db-1",
+			UpdateRevision:     "db-2",
+		},
+	}
+	assert.Contains(t, EvaluateStatefulSetRollout(sts).Message, "2 of 3 pods are ready")
+
+	sts.Status.ReadyReplicas = 3
+	assert.Contains(t, EvaluateStatefulSetRollout(sts).Message, "pods at revision db-2")
+
+	sts.Status.CurrentRevision = "db-2"
+	assert.True(t, EvaluateStatefulSetRollout(sts).Done)
+}
+
+func TestEvaluateDaemonSetRollout(t *testing.T) {
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "agent", Generation: 2},
+		Status:     appsv1.DaemonSetStatus{ObservedGeneration: 1},
+	}
+	assert.Contains(t, EvaluateDaemonSetRollout(ds).Message, "spec update to be observed")
+
+	ds.Status = appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 1}
+	assert.Contains(t, EvaluateDaemonSetRollout(ds).Message, "1 of 3 updated pods are available")
+
+	ds.Status.NumberAvailable = 3
+	assert.True(t, EvaluateDaemonSetRollout(ds).Done)
+}